@@ -9,58 +9,89 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/choria-io/fisk"
 	"github.com/choria-io/tinyhiera"
-	"github.com/choria-io/tinyhiera/internal"
 	"github.com/goccy/go-yaml"
 	"github.com/tidwall/gjson"
 )
 
 var (
-	input      string
-	factsInput map[string]string
-	factsFile  string
-	sysFacts   bool
-	envFacts   bool
-	yamlOutput bool
-	envOutput  bool
-	envPrefix  string
-	dataKey    string
-	version    string
-	query      string
-	debug      bool
+	input          string
+	factsInput     []string
+	factsFiles     []string
+	inferTypes     bool
+	factsDir       string
+	sysFacts       bool
+	envFacts       bool
+	yamlOutput     bool
+	envOutput      bool
+	envPrefix      string
+	dataKey        string
+	version        string
+	query          string
+	debug          bool
+	jsonOutput     bool
+	schemaFile     string
+	lookupKey      string
+	keyMerge       string
+	factsSchema    bool
+	cacheFile      string
+	cacheTTL       time.Duration
+	groupTTL       map[string]string
+	refresh        bool
+	factGroups     []string
+	excludeFact    []string
+	factTimeout    time.Duration
+	envFactsPrefix string
+	envFactsCoerce bool
+	strict         bool
 
 	ctx context.Context
 )
 
 func main() {
-	factsInput = make(map[string]string)
+	groupTTL = make(map[string]string)
 
 	app := fisk.New("cmd", "Choria Hierarchical Data resolver")
 	app.Version(version)
 	app.Author("R.I.Pienaar <rip@choria.io>")
 
 	parse := app.Command("parse", "Parses a YAML or JSON file and prints the result as JSON").Action(runAction)
-	parse.Arg("input", "Input JSON or YAML file to resolve").Envar("HIERA_INPUT").Required().ExistingFileVar(&input)
-	parse.Arg("fact", "Facts about the node").StringMapVar(&factsInput)
-	parse.Flag("facts", "JSON or YAML file containing facts").ExistingFileVar(&factsFile)
-	parse.Flag("system-facts", "Provide facts from the internal facts provider").Short('S').UnNegatableBoolVar(&sysFacts)
-	parse.Flag("env-facts", "Provide facts from the process environment").Short('E').UnNegatableBoolVar(&envFacts)
+	parse.Arg("input", "Input JSON or YAML file or directory to resolve").Envar("HIERA_INPUT").Required().ExistingFileOrDirVar(&input)
+	addFactFlags(parse)
 	parse.Flag("yaml", "Output YAML instead of JSON").UnNegatableBoolVar(&yamlOutput)
 	parse.Flag("env", "Output environment variables").UnNegatableBoolVar(&envOutput)
 	parse.Flag("env-prefix", "Prefix for environment variable names").Default("HIERA").StringVar(&envPrefix)
 	parse.Flag("query", "Performs a gjson query on the result").StringVar(&query)
+	parse.Flag("key", "Resolves only a single key like web.listen_port").StringVar(&lookupKey)
+	parse.Flag("merge", "Merge strategy to use for --key").EnumVar(&keyMerge, tinyhiera.MergeFirst, tinyhiera.MergeHash, tinyhiera.MergeDeep, tinyhiera.MergeUnique, tinyhiera.MergeReplace)
 	parse.Flag("data", "Sets the data key").Default("data").StringVar(&dataKey)
+	parse.Flag("schema", "JSON or YAML JSON Schema file to validate the result against").ExistingFileVar(&schemaFile)
+	parse.Flag("strict", "Fails when expressions use undefined facts without a default").UnNegatableBoolVar(&strict)
 	parse.Flag("debug", "Enables debug output").UnNegatableBoolVar(&debug)
 
+	explain := app.Command("explain", "Shows where every value in the resolved data came from").Action(explainAction)
+	explain.Arg("input", "Input JSON or YAML file or directory to resolve").Envar("HIERA_INPUT").Required().ExistingFileOrDirVar(&input)
+	addFactFlags(explain)
+	explain.Flag("json", "Output JSON instead of text").UnNegatableBoolVar(&jsonOutput)
+	explain.Flag("data", "Sets the data key").Default("data").StringVar(&dataKey)
+	explain.Flag("strict", "Fails when expressions use undefined facts without a default").UnNegatableBoolVar(&strict)
+	explain.Flag("debug", "Enables debug output").UnNegatableBoolVar(&debug)
+
+	lint := app.Command("lint", "Checks a YAML or JSON file for errors without resolving it").Action(lintAction)
+	lint.Arg("input", "Input JSON or YAML file or directory to check").Envar("HIERA_INPUT").Required().ExistingFileOrDirVar(&input)
+	lint.Flag("json", "Output JSON instead of text").UnNegatableBoolVar(&jsonOutput)
+	lint.Flag("data", "Sets the data key").Default("data").StringVar(&dataKey)
+
 	facts := app.Command("facts", "Shows resolved facts").Action(showFactsAction)
-	facts.Arg("fact", "Facts about the node").StringMapVar(&factsInput)
-	facts.Flag("facts", "JSON or YAML file containing facts").ExistingFileVar(&factsFile)
-	facts.Flag("system-facts", "Provide facts from the internal facts provider").Short('S').UnNegatableBoolVar(&sysFacts)
-	facts.Flag("env-facts", "Provide facts from the process environment").Short('E').UnNegatableBoolVar(&envFacts)
+	addFactFlags(facts)
 	facts.Flag("query", "Performs a gjson query on the facts").StringVar(&query)
+	facts.Flag("schema", "Shows the schema describing the system facts").UnNegatableBoolVar(&factsSchema)
 
 	app.PreAction(func(_ *fisk.ParseContext) error {
 		ctx, _ = signal.NotifyContext(context.Background(), os.Interrupt)
@@ -70,7 +101,37 @@ func main() {
 	app.MustParseWithUsage(os.Args[1:])
 }
 
+// addFactFlags adds the flags selecting fact providers shared by all commands that gather facts
+func addFactFlags(cmd *fisk.CmdClause) {
+	cmd.Arg("fact", "Facts about the node like networking.fqdn=example.net or tags=[\"a\"]").StringsVar(&factsInput)
+	cmd.Flag("facts", "JSON or YAML file containing facts, may be repeated").ExistingFilesVar(&factsFiles)
+	cmd.Flag("infer-fact-types", "Converts numbers and booleans in facts given on the command line").UnNegatableBoolVar(&inferTypes)
+	cmd.Flag("facts-dir", "Directory of fact files and executables").ExistingDirVar(&factsDir)
+	cmd.Flag("system-facts", "Provide facts from the internal facts provider").Short('S').UnNegatableBoolVar(&sysFacts)
+	cmd.Flag("env-facts", "Provide facts from the process environment").Short('E').UnNegatableBoolVar(&envFacts)
+	cmd.Flag("env-facts-prefix", "Only use environment variables with this prefix as nested facts, implies --env-facts").StringVar(&envFactsPrefix)
+	cmd.Flag("env-facts-coerce", "Converts numbers, booleans and JSON in nested environment facts, implies --env-facts").UnNegatableBoolVar(&envFactsCoerce)
+	cmd.Flag("fact-groups", "Comma separated system fact groups to gather, implies --system-facts").StringsVar(&factGroups)
+	cmd.Flag("exclude-fact-groups", "Comma separated system fact groups not to gather, implies --system-facts").StringsVar(&excludeFact)
+	cmd.Flag("fact-group-timeout", "How long a group of system facts may take to gather").Default(tinyhiera.DefaultFactGroupTimeout.String()).DurationVar(&factTimeout)
+	cmd.Flag("facts-cache", "File to cache system facts in").Envar("HIERA_FACTS_CACHE").StringVar(&cacheFile)
+	cmd.Flag("facts-cache-ttl", "How long cached system facts are used").Default(tinyhiera.DefaultFactsCacheTTL.String()).DurationVar(&cacheTTL)
+	cmd.Flag("facts-group-ttl", "How long a group of cached system facts is used like partitions=1h").StringMapVar(&groupTTL)
+	cmd.Flag("refresh-facts", "Gathers fresh system facts ignoring the cache").UnNegatableBoolVar(&refresh)
+}
+
 func showFactsAction(_ *fisk.ParseContext) error {
+	if factsSchema {
+		j, err := json.MarshalIndent(tinyhiera.SystemFactsSchema(), "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(j))
+
+		return nil
+	}
+
 	facts, err := resolveFacts()
 	if err != nil {
 		return err
@@ -97,22 +158,16 @@ func runAction(_ *fisk.ParseContext) error {
 		return err
 	}
 
-	data, err := os.ReadFile(input)
+	resolver, err := loadResolver()
 	if err != nil {
 		return err
 	}
 
-	var res map[string]any
-	var logger tinyhiera.Logger
-
-	if debug {
-		logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	}
-
-	if isJson(data) {
-		res, err = tinyhiera.ResolveJson(data, facts, tinyhiera.Options{DataKey: dataKey}, logger)
+	var res any
+	if lookupKey != "" {
+		res, err = resolver.Lookup(ctx, facts, lookupKey, keyMerge)
 	} else {
-		res, err = tinyhiera.ResolveYaml(data, facts, tinyhiera.Options{DataKey: dataKey}, logger)
+		res, err = resolver.Resolve(ctx, facts)
 	}
 	if err != nil {
 		return err
@@ -134,8 +189,13 @@ func runAction(_ *fisk.ParseContext) error {
 	case yamlOutput:
 		out, err = yaml.Marshal(res)
 	case envOutput:
+		data, ok := res.(map[string]any)
+		if !ok {
+			return fmt.Errorf("environment variables can only be rendered for a map")
+		}
+
 		buff := bytes.NewBuffer([]byte{})
-		err = renderEnvOutput(buff, res)
+		err = renderEnvOutput(buff, data)
 		if err != nil {
 			return err
 		}
@@ -152,6 +212,164 @@ func runAction(_ *fisk.ParseContext) error {
 	return nil
 }
 
+func explainAction(_ *fisk.ParseContext) error {
+	facts, err := resolveFacts()
+	if err != nil {
+		return err
+	}
+
+	resolver, err := loadResolver()
+	if err != nil {
+		return err
+	}
+
+	_, trace, err := resolver.ResolveWithTrace(ctx, facts)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		j, err := json.MarshalIndent(trace, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(j))
+
+		return nil
+	}
+
+	for i, entry := range trace {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		fmt.Printf("%s = %s\n", entry.Path, formatTraceValue(entry.Value))
+		fmt.Printf("    set by %s\n", formatTraceLayer(entry.TraceLayer))
+		for _, shadowed := range slices.Backward(entry.Shadowed) {
+			fmt.Printf("    shadows %s = %s\n", formatTraceLayer(shadowed), formatTraceValue(shadowed.Value))
+		}
+	}
+
+	return nil
+}
+
+func lintAction(_ *fisk.ParseContext) error {
+	root, err := loadDocument()
+	if err != nil {
+		return err
+	}
+
+	issues := tinyhiera.Lint(root, tinyhiera.Options{DataKey: dataKey})
+
+	errs := 0
+	for _, issue := range issues {
+		if issue.Severity == tinyhiera.LintError {
+			errs++
+		}
+	}
+
+	if jsonOutput {
+		if issues == nil {
+			issues = []tinyhiera.LintIssue{}
+		}
+
+		j, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(j))
+	} else {
+		for _, issue := range issues {
+			fmt.Printf("%-7s %s\n", issue.Severity, issue)
+		}
+
+		if len(issues) == 0 {
+			fmt.Printf("%s: no problems found\n", input)
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%s: found %d error(s) and %d warning(s)", input, errs, len(issues)-errs)
+	}
+
+	return nil
+}
+
+func formatTraceLayer(layer tinyhiera.TraceLayer) string {
+	var details []string
+	if layer.Entry != "" && layer.Entry != layer.Layer {
+		details = append(details, layer.Entry)
+	}
+	if layer.Pattern != "" {
+		details = append(details, "override "+layer.Pattern)
+	}
+
+	if len(details) == 0 {
+		return layer.Layer
+	}
+
+	return fmt.Sprintf("%s (%s)", layer.Layer, strings.Join(details, ", "))
+}
+
+func formatTraceValue(value any) string {
+	j, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(j)
+}
+
+// loadDocument reads the input document and its imports, a directory is read in directory mode. Imports are read
+// relative to the input and can not refer to files outside the directory holding it
+func loadDocument() (map[string]any, error) {
+	path := filepath.Clean(input)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if stat.IsDir() {
+		return tinyhiera.LoadDocument(os.DirFS(path), ".")
+	}
+
+	return tinyhiera.LoadDocument(os.DirFS(filepath.Dir(path)), filepath.Base(path))
+}
+
+// loadResolver reads and compiles the input document
+func loadResolver() (*tinyhiera.Resolver, error) {
+	root, err := loadDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := tinyhiera.Options{DataKey: dataKey, Strict: strict}
+	if debug {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	if schemaFile != "" {
+		sc, err := os.ReadFile(schemaFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if isJson(sc) {
+			err = json.Unmarshal(sc, &opts.Schema)
+		} else {
+			err = yaml.Unmarshal(sc, &opts.Schema)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %w", schemaFile, err)
+		}
+	}
+
+	return tinyhiera.New(root, opts)
+}
+
 func renderEnvOutput(w io.Writer, res map[string]any) error {
 	for k, v := range res {
 		key := fmt.Sprintf("%s_%s", envPrefix, strings.ToUpper(k))
@@ -181,45 +399,82 @@ func isJson(data []byte) bool {
 	return strings.HasPrefix(string(trimmed), "{") || strings.HasPrefix(string(trimmed), "[")
 }
 
-func resolveFacts() (map[string]any, error) {
-	facts := make(map[string]any)
-
-	if sysFacts {
-		sf, err := internal.StandardFacts(ctx)
-		if err != nil {
-			return nil, err
-		}
-		for k, v := range sf {
-			facts[k] = v
+// splitList splits comma separated items in values
+func splitList(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				result = append(result, item)
+			}
 		}
 	}
 
-	if envFacts {
-		for _, v := range os.Environ() {
-			kv := strings.Split(v, "=")
-			facts[kv[0]] = kv[1]
-		}
-	}
+	return result
+}
 
-	if factsFile != "" {
-		fc, err := os.ReadFile(factsFile)
+// resolveFacts gathers facts from the providers selected on the command line, later providers take precedence
+func resolveFacts() (map[string]any, error) {
+	registry := tinyhiera.NewFactRegistry()
+
+	var providers []tinyhiera.FactProvider
+	if sysFacts || len(factGroups) > 0 || len(excludeFact) > 0 {
+		provider, err := tinyhiera.SelectSystemFacts(tinyhiera.SystemFactsOptions{
+			Groups:  splitList(factGroups),
+			Exclude: splitList(excludeFact),
+			Timeout: factTimeout,
+		})
 		if err != nil {
 			return nil, err
 		}
 
-		if isJson(fc) {
-			err = json.Unmarshal(fc, &facts)
-		} else {
-			err = yaml.Unmarshal(fc, &facts)
+		if cacheFile != "" {
+			cache := tinyhiera.FactCache{
+				Path:     cacheFile,
+				TTL:      cacheTTL,
+				GroupTTL: map[string]time.Duration{},
+				Refresh:  refresh,
+			}
+
+			for group, v := range groupTTL {
+				ttl, err := time.ParseDuration(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ttl for fact group %s: %w", group, err)
+				}
+				cache.GroupTTL[group] = ttl
+			}
+
+			provider = tinyhiera.CachedFacts(provider, cache)
 		}
+
+		providers = append(providers, provider)
+	}
+	switch {
+	case envFactsPrefix != "" || envFactsCoerce:
+		providers = append(providers, tinyhiera.PrefixedEnvFacts(envFactsPrefix, envFactsCoerce))
+	case envFacts:
+		providers = append(providers, tinyhiera.EnvFacts())
+	}
+	if factsDir != "" {
+		providers = append(providers, tinyhiera.DirFacts(factsDir, 0))
+	}
+	for _, file := range factsFiles {
+		providers = append(providers, tinyhiera.FileFacts(file))
+	}
+
+	cliFacts, err := tinyhiera.ParseFactArgs(factsInput, inferTypes)
+	if err != nil {
+		return nil, err
+	}
+	providers = append(providers, tinyhiera.StaticFacts("cli", cliFacts))
+
+	for _, provider := range providers {
+		err := registry.Register(provider, "")
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	for k, v := range factsInput {
-		facts[k] = v
-	}
-
-	return facts, nil
+	return registry.Facts(ctx)
 }
@@ -0,0 +1,210 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dataRefs evaluates templates that call data() once all layers are merged. Templates are evaluated on demand as
+// they are referenced so values can refer to each other in any order, results replace the templates in the data.
+type dataRefs struct {
+	// data is the merged data holding templates that still need evaluation
+	data map[string]any
+	// env is the expression environment including the data() function
+	env map[string]any
+	// branch is the only path held in data when resolving a single key, nil when data is complete
+	branch []string
+	// fetch resolves a path outside of branch
+	fetch func(path []string) (any, bool, error)
+	// active is the stack of paths being evaluated, shared with nested lookups to detect circular references
+	active *[]string
+	// err is the first error from a data() reference, it is reported as is rather than wrapped by every expression in the chain
+	err error
+}
+
+func newDataRefs(data map[string]any, env map[string]any, active *[]string) *dataRefs {
+	if active == nil {
+		active = &[]string{}
+	}
+
+	d := &dataRefs{data: data, env: cloneMap(env), active: active}
+	d.env["data"] = d.lookup
+
+	return d
+}
+
+// resolve evaluates every template in the data
+func (d *dataRefs) resolve() error {
+	_, err := d.resolveValue(nil, d.data)
+	return err
+}
+
+// lookup implements the data() expression function, it returns a copy of the value at key or the default
+func (d *dataRefs) lookup(key string, args ...any) (any, error) {
+	var dflt any = ""
+	if len(args) >= 1 {
+		dflt = args[0]
+	}
+
+	value, found, err := d.get(splitPath(key))
+	if err != nil {
+		if d.err == nil {
+			d.err = err
+		}
+		return nil, err
+	}
+	if !found {
+		return dflt, nil
+	}
+
+	return cloneValue(value), nil
+}
+
+// get finds the value at path evaluating any templates on the way to and within the value
+func (d *dataRefs) get(path []string) (any, bool, error) {
+	if d.branch != nil && !hasPathPrefix(path, d.branch) {
+		return d.fetch(path)
+	}
+
+	var value any = d.data
+	for i, segment := range path {
+		var next any
+
+		switch typed := value.(type) {
+		case map[string]any:
+			v, ok := typed[segment]
+			if !ok {
+				return nil, false, nil
+			}
+			next = v
+
+			if t, ok := v.(*template); ok {
+				res, err := d.evalAt(path[:i+1], t)
+				if err != nil {
+					return nil, false, err
+				}
+				typed[segment] = res
+				next = res
+			}
+
+		case []any:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(typed) {
+				return nil, false, nil
+			}
+			next = typed[idx]
+
+			if t, ok := next.(*template); ok {
+				res, err := d.evalAt(path[:i+1], t)
+				if err != nil {
+					return nil, false, err
+				}
+				typed[idx] = res
+				next = res
+			}
+
+		default:
+			return nil, false, nil
+		}
+
+		value = next
+	}
+
+	res, err := d.resolveValue(path, value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return res, true, nil
+}
+
+// resolveValue evaluates all templates in value, which is found at path, updating maps and slices in place
+func (d *dataRefs) resolveValue(path []string, value any) (any, error) {
+	switch typed := value.(type) {
+	case *template:
+		return d.evalAt(path, typed)
+
+	case map[string]any:
+		for key, val := range typed {
+			res, err := d.resolveValue(append(slices.Clone(path), key), val)
+			if err != nil {
+				return nil, err
+			}
+			typed[key] = res
+		}
+
+	case []any:
+		for i, val := range typed {
+			res, err := d.resolveValue(append(slices.Clone(path), strconv.Itoa(i)), val)
+			if err != nil {
+				return nil, err
+			}
+			typed[i] = res
+		}
+	}
+
+	return value, nil
+}
+
+// evalAt evaluates the template found at path detecting circular references
+func (d *dataRefs) evalAt(path []string, t *template) (any, error) {
+	name := tracePath(path)
+
+	if idx := slices.Index(*d.active, name); idx >= 0 {
+		chain := append(slices.Clone((*d.active)[idx:]), name)
+		d.err = fmt.Errorf("circular data reference: %s", strings.Join(chain, " -> "))
+		return nil, d.err
+	}
+
+	*d.active = append(*d.active, name)
+	defer func() { *d.active = (*d.active)[:len(*d.active)-1] }()
+
+	env := d.env
+	if t.captures != nil {
+		env = maps.Clone(d.env)
+		env[capturesVariable] = t.captures
+	}
+
+	res, err := t.evalTyped(env)
+	switch {
+	case d.err != nil:
+		return nil, d.err
+	case errors.As(err, new(*UndefinedFactError)):
+		return nil, undefinedAt(err, path...)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return res, nil
+}
+
+// refsData determines if any template in a structure produced by compileValue calls data()
+func refsData(value any) bool {
+	switch typed := value.(type) {
+	case *template:
+		return typed.refsData
+	case map[string]any:
+		for _, val := range typed {
+			if refsData(val) {
+				return true
+			}
+		}
+	case []any:
+		return slices.ContainsFunc(typed, refsData)
+	}
+
+	return false
+}
+
+// hasPathPrefix determines if path starts with all the segments in prefix
+func hasPathPrefix(path []string, prefix []string) bool {
+	return len(path) >= len(prefix) && slices.Equal(path[:len(prefix)], prefix)
+}
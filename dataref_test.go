@@ -0,0 +1,98 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Data references", func() {
+	doc := []byte(`
+hierarchy:
+  order:
+    - env:{{ lookup('env') }}
+  merge: deep
+
+data:
+  url: "https://{{ data('web.host') }}:{{ data('web.listen_port') }}"
+  listen: "{{ data('web.listen_port') }}"
+  web:
+    host: "{{ data('hosts.0') }}.example.net"
+    listen_port: 80
+  hosts:
+    - "{{ lookup('hostname') }}"
+  fallback: "{{ data('missing', 'default') }}"
+  copy: "{{ data('web') }}"
+
+overrides:
+  env:prod:
+    web:
+      listen_port: 443
+`)
+
+	It("Should reference the merged data", func() {
+		res, err := ResolveYaml(doc, map[string]any{"env": "prod", "hostname": "web01"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res["url"]).To(Equal("https://web01.example.net:443"))
+		Expect(res["listen"]).To(Equal(443))
+		Expect(res["fallback"]).To(Equal("default"))
+		Expect(res["copy"]).To(Equal(map[string]any{"host": "web01.example.net", "listen_port": 443}))
+
+		res, err = ResolveYaml(doc, map[string]any{"hostname": "dev01"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res["url"]).To(Equal("https://dev01.example.net:80"))
+	})
+
+	It("Should support references in single key lookups", func() {
+		resolver, err := NewYaml(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := resolver.Lookup(context.Background(), map[string]any{"env": "prod", "hostname": "web01"}, "url", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal("https://web01.example.net:443"))
+	})
+
+	It("Should trace the evaluated values", func() {
+		_, trace, err := ResolveWithTrace(map[string]any{
+			"hierarchy": map[string]any{"order": []any{"global"}, "merge": "deep"},
+			"data":      map[string]any{"a": "{{ data('b') }}", "b": 1},
+			"overrides": map[string]any{"global": map[string]any{"a": "{{ data('b') + 1 }}"}},
+		}, nil, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trace[0]).To(Equal(TraceEntry{
+			Path:       "a",
+			TraceLayer: TraceLayer{Layer: "global", Entry: "global", Value: 2},
+			Shadowed:   []TraceLayer{{Layer: "data", Value: "{{ data('b') }}"}},
+		}))
+	})
+
+	It("Should detect circular references", func() {
+		_, err := ResolveYaml([]byte(`
+data:
+  a: "{{ data('b.c') }}"
+  b:
+    c: "x{{ data('d') }}"
+  d: "{{ data('a') }}"
+`), nil, DefaultOptions, nil)
+		Expect(err).To(MatchError(MatchRegexp(`^circular data reference: (a -> b\.c -> d -> a|b\.c -> d -> a -> b\.c|d -> a -> b\.c -> d)$`)))
+
+		resolver, err := NewYaml([]byte(`
+data:
+  a: "{{ data('b') }}"
+  b: "{{ data('a') }}"
+`), DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = resolver.Lookup(context.Background(), nil, "a", "")
+		Expect(err).To(MatchError("circular data reference: a -> b -> a"))
+	})
+
+	It("Should not allow references in the hierarchy", func() {
+		_, err := New(map[string]any{"hierarchy": map[string]any{"order": []any{"{{ data('x') }}"}}}, DefaultOptions)
+		Expect(err).To(MatchError(`hierarchy order entry "{{ data('x') }}" can not use data()`))
+	})
+})
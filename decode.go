@@ -0,0 +1,438 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodeError reports a value in the resolved data that could not be decoded into the target type
+type DecodeError struct {
+	// Path is the gjson path to the value in the resolved data
+	Path string
+	// Expected is the Go type the value had to be decoded into
+	Expected string
+	// Got describes the value that was found
+	Got string
+	// Err is an optional underlying error
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "data"
+	}
+
+	if e.Err != nil {
+		return fmt.Sprintf("%s: cannot decode %s into %s: %v", path, e.Got, e.Expected, e.Err)
+	}
+
+	return fmt.Sprintf("%s: expected %s but got %s", path, e.Expected, e.Got)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveInto resolves the document like Resolve and decodes the result into a new T, see Decode for details
+func ResolveInto[T any](root map[string]any, facts map[string]any, opts Options, log Logger) (T, error) {
+	var target T
+
+	res, err := Resolve(root, facts, opts, log)
+	if err != nil {
+		return target, err
+	}
+
+	err = Decode(res, &target)
+
+	return target, err
+}
+
+// ResolveInto evaluates the compiled document against facts and decodes the result into target, see Decode for details
+func (r *Resolver) ResolveInto(ctx context.Context, facts map[string]any, target any) error {
+	res, err := r.Resolve(ctx, facts)
+	if err != nil {
+		return err
+	}
+
+	return Decode(res, target)
+}
+
+// Decode decodes resolved data into target which must be a non nil pointer.
+//
+// Struct fields are matched using their yaml tag, then their json tag and finally their name without regard to case.
+// Keys without a matching field are decoded into a map field tagged inline, or ignored when there is none. Every value that can not be decoded is reported as a *DecodeError
+// naming its path, multiple errors are joined.
+func Decode(data any, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("decode target must be a non nil pointer")
+	}
+
+	d := &decoder{}
+	d.decode(nil, data, rv.Elem())
+
+	return errors.Join(d.errs...)
+}
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+type decoder struct {
+	errs []error
+}
+
+func (d *decoder) fail(path []string, target reflect.Value, value any, err error) {
+	d.errs = append(d.errs, &DecodeError{
+		Path:     tracePath(path),
+		Expected: target.Type().String(),
+		Got:      describeValue(value),
+		Err:      err,
+	})
+}
+
+func (d *decoder) decode(path []string, value any, target reflect.Value) {
+	if value == nil {
+		target.SetZero()
+		return
+	}
+
+	if target.CanAddr() && target.Addr().Type().Implements(textUnmarshalerType) {
+		if s, ok := value.(string); ok {
+			err := target.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+			if err != nil {
+				d.fail(path, target, value, err)
+			}
+			return
+		}
+	}
+
+	if target.Type() == durationType {
+		d.decodeDuration(path, value, target)
+		return
+	}
+
+	switch target.Kind() {
+	case reflect.Pointer:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		d.decode(path, value, target.Elem())
+
+	case reflect.Interface:
+		rv := reflect.ValueOf(value)
+		if !rv.Type().AssignableTo(target.Type()) {
+			d.fail(path, target, value, nil)
+			return
+		}
+		target.Set(rv)
+
+	case reflect.Struct:
+		d.decodeStruct(path, value, target)
+
+	case reflect.Map:
+		d.decodeMap(path, value, target)
+
+	case reflect.Slice, reflect.Array:
+		d.decodeSlice(path, value, target)
+
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			d.fail(path, target, value, nil)
+			return
+		}
+		target.SetString(s)
+
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			d.fail(path, target, value, nil)
+			return
+		}
+		target.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := toInt64(value)
+		if !ok || target.OverflowInt(i) {
+			d.fail(path, target, value, nil)
+			return
+		}
+		target.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := toInt64(value)
+		if !ok || i < 0 || target.OverflowUint(uint64(i)) {
+			d.fail(path, target, value, nil)
+			return
+		}
+		target.SetUint(uint64(i))
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat64(value)
+		if !ok || target.OverflowFloat(f) {
+			d.fail(path, target, value, nil)
+			return
+		}
+		target.SetFloat(f)
+
+	default:
+		d.fail(path, target, value, fmt.Errorf("unsupported type"))
+	}
+}
+
+func (d *decoder) decodeDuration(path []string, value any, target reflect.Value) {
+	switch typed := value.(type) {
+	case string:
+		duration, err := time.ParseDuration(typed)
+		if err != nil {
+			d.fail(path, target, value, err)
+			return
+		}
+		target.SetInt(int64(duration))
+	default:
+		i, ok := toInt64(value)
+		if !ok {
+			d.fail(path, target, value, nil)
+			return
+		}
+		target.SetInt(i)
+	}
+}
+
+func (d *decoder) decodeStruct(path []string, value any, target reflect.Value) {
+	data, ok := value.(map[string]any)
+	if !ok {
+		d.fail(path, target, value, nil)
+		return
+	}
+
+	claimed := map[string]bool{}
+	var rest []reflect.Value
+	d.decodeFields(path, data, target, claimed, &rest)
+
+	if len(rest) == 0 {
+		return
+	}
+
+	remaining := map[string]any{}
+	for key, val := range data {
+		if !claimed[key] {
+			remaining[key] = val
+		}
+	}
+
+	d.decodeMap(path, remaining, rest[0])
+}
+
+// decodeFields decodes data into the fields of target and inline structs recording the keys used in claimed, inline
+// maps are added to rest to receive the keys no field claimed
+func (d *decoder) decodeFields(path []string, data map[string]any, target reflect.Value, claimed map[string]bool, rest *[]reflect.Value) {
+	t := target.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		// embedded structs with unexported types still have exported fields we can set
+		if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			continue
+		}
+
+		name, inline, skip := fieldName(field)
+		if skip {
+			continue
+		}
+
+		if inline {
+			switch field.Type.Kind() {
+			case reflect.Struct:
+				d.decodeFields(path, data, target.Field(i), claimed, rest)
+			case reflect.Map:
+				*rest = append(*rest, target.Field(i))
+			}
+			continue
+		}
+
+		key, found := findKey(data, name, !hasTagName(field))
+		if !found {
+			continue
+		}
+
+		claimed[key] = true
+		d.decode(append(slices.Clone(path), key), data[key], target.Field(i))
+	}
+}
+
+func (d *decoder) decodeMap(path []string, value any, target reflect.Value) {
+	data, ok := value.(map[string]any)
+	if !ok {
+		d.fail(path, target, value, nil)
+		return
+	}
+
+	t := target.Type()
+	if t.Key().Kind() != reflect.String {
+		d.fail(path, target, value, fmt.Errorf("map keys must be strings"))
+		return
+	}
+
+	if target.IsNil() {
+		target.Set(reflect.MakeMapWithSize(t, len(data)))
+	}
+
+	for key, val := range data {
+		elem := reflect.New(t.Elem()).Elem()
+		d.decode(append(slices.Clone(path), key), val, elem)
+		target.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), elem)
+	}
+}
+
+func (d *decoder) decodeSlice(path []string, value any, target reflect.Value) {
+	data, ok := value.([]any)
+	if !ok {
+		d.fail(path, target, value, nil)
+		return
+	}
+
+	if target.Kind() == reflect.Array {
+		if len(data) > target.Len() {
+			d.fail(path, target, value, fmt.Errorf("too many entries"))
+			return
+		}
+	} else {
+		target.Set(reflect.MakeSlice(target.Type(), len(data), len(data)))
+	}
+
+	for i, val := range data {
+		d.decode(append(slices.Clone(path), strconv.Itoa(i)), val, target.Index(i))
+	}
+}
+
+// fieldName determines the key a struct field is decoded from using its yaml or json tags
+func fieldName(field reflect.StructField) (name string, inline bool, skip bool) {
+	for _, tagName := range []string{"yaml", "json"} {
+		tag, ok := field.Tag.Lookup(tagName)
+		if !ok {
+			continue
+		}
+
+		if tag == "-" {
+			return "", false, true
+		}
+
+		parts := strings.Split(tag, ",")
+		for _, opt := range parts[1:] {
+			if opt == "inline" {
+				return "", true, false
+			}
+		}
+
+		if parts[0] != "" {
+			return parts[0], false, false
+		}
+	}
+
+	return field.Name, field.Anonymous && field.Type.Kind() == reflect.Struct, false
+}
+
+// hasTagName determines if a field has an explicit name in its yaml or json tags
+func hasTagName(field reflect.StructField) bool {
+	for _, tagName := range []string{"yaml", "json"} {
+		tag, ok := field.Tag.Lookup(tagName)
+		if ok && strings.Split(tag, ",")[0] != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findKey finds name in data, case-insensitive matching is used when fold is true and no exact match exist
+func findKey(data map[string]any, name string, fold bool) (string, bool) {
+	if _, ok := data[name]; ok {
+		return name, true
+	}
+
+	if !fold {
+		return "", false
+	}
+
+	for key := range data {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// describeValue describes the type of resolved data for use in errors
+func describeValue(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "map"
+	case []any:
+		return "list"
+	case string:
+		return fmt.Sprintf("string %q", typed)
+	default:
+		return fmt.Sprintf("%T %v", value, value)
+	}
+}
+
+func toInt64(value any) (int64, bool) {
+	switch typed := value.(type) {
+	case int:
+		return int64(typed), true
+	case int8:
+		return int64(typed), true
+	case int16:
+		return int64(typed), true
+	case int32:
+		return int64(typed), true
+	case int64:
+		return typed, true
+	case uint:
+		return int64(typed), typed <= math.MaxInt64
+	case uint8:
+		return int64(typed), true
+	case uint16:
+		return int64(typed), true
+	case uint32:
+		return int64(typed), true
+	case uint64:
+		return int64(typed), typed <= math.MaxInt64
+	case float32:
+		return int64(typed), float64(typed) == math.Trunc(float64(typed))
+	case float64:
+		return int64(typed), typed == math.Trunc(typed) && typed >= math.MinInt64 && typed <= math.MaxInt64
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(value any) (float64, bool) {
+	switch typed := value.(type) {
+	case float32:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	default:
+		i, ok := toInt64(value)
+		return float64(i), ok
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type decodeTestUser struct {
+	Name   string   `json:"name"`
+	Groups []string `yaml:"groups"`
+}
+
+type decodeTestCommon struct {
+	LogLevel string `yaml:"log_level"`
+}
+
+type decodeTestConfig struct {
+	decodeTestCommon `yaml:",inline"`
+
+	Packages []string          `yaml:"packages"`
+	Users    []decodeTestUser  `yaml:"users"`
+	Labels   map[string]string `json:"labels"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Listen   netip.Addr        `yaml:"listen"`
+	Ratio    float64
+	Web      *struct {
+		Port uint16 `yaml:"listen_port"`
+		TLS  bool   `yaml:"tls"`
+	} `yaml:"web"`
+	Extra   any    `yaml:"extra"`
+	Ignored string `yaml:"-"`
+}
+
+var _ = Describe("Decode", func() {
+	doc := map[string]any{
+		"hierarchy": map[string]any{
+			"order": []any{"role:{{ lookup('role') }}"},
+			"merge": "deep",
+		},
+		"data": map[string]any{
+			"log_level": "INFO",
+			"packages":  []any{"ca-certificates"},
+			"users":     []any{map[string]any{"name": "root", "groups": []any{"wheel"}}},
+			"labels":    map[string]any{"env": "prod"},
+			"timeout":   "10s",
+			"listen":    "127.0.0.1",
+			"ratio":     1,
+			"web":       map[string]any{"listen_port": "{{ lookup('port', 80) }}", "tls": false},
+			"extra":     []any{1, "two"},
+			"Ignored":   "x",
+		},
+		"overrides": map[string]any{
+			"role:web": map[string]any{
+				"packages": []any{"nginx"},
+				"web":      map[string]any{"tls": true},
+			},
+		},
+	}
+
+	It("Should decode resolved data into structs", func() {
+		cfg, err := ResolveInto[decodeTestConfig](doc, map[string]any{"role": "web", "port": 443}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cfg.LogLevel).To(Equal("INFO"))
+		Expect(cfg.Packages).To(Equal([]string{"ca-certificates", "nginx"}))
+		Expect(cfg.Users).To(Equal([]decodeTestUser{{Name: "root", Groups: []string{"wheel"}}}))
+		Expect(cfg.Labels).To(Equal(map[string]string{"env": "prod"}))
+		Expect(cfg.Timeout).To(Equal(10 * time.Second))
+		Expect(cfg.Listen).To(Equal(netip.MustParseAddr("127.0.0.1")))
+		Expect(cfg.Ratio).To(Equal(1.0))
+		Expect(cfg.Web.Port).To(Equal(uint16(443)))
+		Expect(cfg.Web.TLS).To(BeTrue())
+		Expect(cfg.Extra).To(Equal([]any{1, "two"}))
+		Expect(cfg.Ignored).To(BeEmpty())
+	})
+
+	It("Should decode using a compiled resolver", func() {
+		resolver, err := New(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		var cfg decodeTestConfig
+		Expect(resolver.ResolveInto(context.Background(), map[string]any{}, &cfg)).To(Succeed())
+		Expect(cfg.Web.Port).To(Equal(uint16(80)))
+	})
+
+	It("Should report every invalid value with its path", func() {
+		_, err := ResolveInto[decodeTestConfig](doc, map[string]any{"port": 70000, "role": "web"}, DefaultOptions, nil)
+		Expect(err).To(MatchError("web.listen_port: expected uint16 but got int64 70000"))
+
+		var de *DecodeError
+		Expect(errors.As(err, &de)).To(BeTrue())
+		Expect(de.Path).To(Equal("web.listen_port"))
+
+		err = Decode(map[string]any{
+			"packages": []any{"a", 1},
+			"users":    "root",
+			"timeout":  "soon",
+		}, &decodeTestConfig{})
+		Expect(err).To(MatchError(ContainSubstring("packages.1: expected string but got int 1")))
+		Expect(err).To(MatchError(ContainSubstring("users: expected []tinyhiera.decodeTestUser but got string \"root\"")))
+		Expect(err).To(MatchError(ContainSubstring(`timeout: cannot decode string "soon" into time.Duration`)))
+	})
+
+	It("Should decode keys no field claimed into inline maps", func() {
+		var target struct {
+			decodeTestCommon `yaml:",inline"`
+
+			Name  string         `yaml:"name"`
+			Extra map[string]any `yaml:",inline"`
+		}
+
+		err := Decode(map[string]any{"name": "x", "log_level": "INFO", "other": 1, "nested": map[string]any{"a": true}}, &target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target.Name).To(Equal("x"))
+		Expect(target.LogLevel).To(Equal("INFO"))
+		Expect(target.Extra).To(Equal(map[string]any{"other": 1, "nested": map[string]any{"a": true}}))
+
+		var typed struct {
+			Name  string         `yaml:"name"`
+			Ports map[string]int `yaml:",inline"`
+		}
+		err = Decode(map[string]any{"name": "x", "http": "80"}, &typed)
+		Expect(err).To(MatchError(`http: expected int but got string "80"`))
+	})
+
+	It("Should require a pointer target", func() {
+		Expect(Decode(map[string]any{}, decodeTestConfig{})).To(MatchError("decode target must be a non nil pointer"))
+	})
+})
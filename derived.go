@@ -0,0 +1,165 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+)
+
+// derivedFact is a fact computed from other facts by the facts section of the document
+type derivedFact struct {
+	name  string
+	value any
+}
+
+// compileDerivedFacts compiles the facts section of the document and orders the facts so every fact comes after the
+// derived facts it uses. A fact using its own name refers to the fact that was supplied to the resolver
+func compileDerivedFacts(raw any) ([]derivedFact, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	section, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("facts must be a map")
+	}
+
+	compiled := map[string]any{}
+	for name, value := range section {
+		c, err := compileValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("facts.%s: %w", name, err)
+		}
+		if refsData(c) {
+			return nil, fmt.Errorf("facts.%s: derived facts can not use data()", name)
+		}
+		compiled[name] = c
+	}
+
+	deps := map[string][]string{}
+	for name, value := range compiled {
+		for _, ref := range factRefs(value) {
+			if _, ok := compiled[ref]; ok && ref != name && !slices.Contains(deps[name], ref) {
+				deps[name] = append(deps[name], ref)
+			}
+		}
+		slices.Sort(deps[name])
+	}
+
+	var (
+		ordered []derivedFact
+		stack   []string
+		done    = map[string]bool{}
+		visit   func(name string) error
+	)
+
+	visit = func(name string) error {
+		if done[name] {
+			return nil
+		}
+
+		if start := slices.Index(stack, name); start >= 0 {
+			return fmt.Errorf("circular fact reference: %s", strings.Join(append(slices.Clone(stack[start:]), name), " -> "))
+		}
+
+		stack = append(stack, name)
+		for _, dep := range deps[name] {
+			err := visit(dep)
+			if err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+
+		done[name] = true
+		ordered = append(ordered, derivedFact{name: name, value: compiled[name]})
+
+		return nil
+	}
+
+	for _, name := range sortedKeys(compiled) {
+		err := visit(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// deriveFacts returns the expression environment for facts with the derived facts added
+func deriveFacts(derived []derivedFact, facts map[string]any, strict bool) (map[string]any, error) {
+	env, add, err := genOverlayExprEnv(facts, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fact := range derived {
+		value, err := evalValue(fact.value, env)
+		switch {
+		case errors.As(err, new(*UndefinedFactError)):
+			return nil, undefinedAt(err, "facts", fact.name)
+		case err != nil:
+			return nil, fmt.Errorf("facts.%s: %w", fact.name, err)
+		}
+
+		err = add(fact.name, value)
+		if err != nil {
+			return nil, fmt.Errorf("facts.%s: %w", fact.name, err)
+		}
+	}
+
+	return env, nil
+}
+
+// factRefs lists the top level facts the templates in a compiled value refer to as variables or using lookup()
+func factRefs(value any) []string {
+	var refs []string
+
+	switch typed := value.(type) {
+	case *template:
+		for _, compiled := range typed.expressions {
+			node := compiled.program.Node()
+			v := &factRefVisitor{}
+			ast.Walk(&node, v)
+			refs = append(refs, v.refs...)
+		}
+	case map[string]any:
+		for _, val := range typed {
+			refs = append(refs, factRefs(val)...)
+		}
+	case []any:
+		for _, val := range typed {
+			refs = append(refs, factRefs(val)...)
+		}
+	}
+
+	return refs
+}
+
+type factRefVisitor struct {
+	refs []string
+}
+
+func (v *factRefVisitor) Visit(node *ast.Node) {
+	switch typed := (*node).(type) {
+	case *ast.IdentifierNode:
+		v.refs = append(v.refs, typed.Value)
+	case *ast.CallNode:
+		ident, ok := typed.Callee.(*ast.IdentifierNode)
+		if !ok || ident.Value != "lookup" || len(typed.Arguments) == 0 {
+			return
+		}
+		if key, ok := typed.Arguments[0].(*ast.StringNode); ok {
+			name, _, _ := strings.Cut(key.Value, ".")
+			v.refs = append(v.refs, name)
+		}
+	}
+}
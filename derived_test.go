@@ -0,0 +1,112 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Derived facts", func() {
+	It("Should derive facts in dependency order", func() {
+		root := map[string]any{
+			"facts": map[string]any{
+				"site":     "{{ upper(dc) }}",
+				"dc":       "{{ split(lookup('networking.fqdn'), '.')[1] }}",
+				"location": map[string]any{"site": "{{ lookup('site') }}", "dc": "{{ dc }}"},
+				"role":     "{{ lower(role) }}",
+			},
+			"hierarchy": map[string]any{
+				"order": []any{"site:{{ site }}", "role:{{ role }}"},
+				"merge": "deep",
+			},
+			"data": map[string]any{
+				"location": "{{ location }}",
+				"role":     "",
+			},
+			"overrides": map[string]any{
+				"site:LON": map[string]any{"ntp": "ntp.lon"},
+				"role:web": map[string]any{"role": "{{ role }}"},
+			},
+		}
+
+		res, err := Resolve(root, map[string]any{"networking": map[string]any{"fqdn": "web01.lon.example.net"}, "role": "WEB"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{
+			"location": map[string]any{"site": "LON", "dc": "lon"},
+			"role":     "web",
+			"ntp":      "ntp.lon",
+		}))
+	})
+
+	It("Should find derived facts using lookup", func() {
+		root := map[string]any{
+			"facts": map[string]any{
+				"location": map[string]any{"site": "lon", "racks": []any{"r1", "r2"}},
+				"role":     "{{ lower(role) }}",
+			},
+			"data": map[string]any{
+				"site":    "{{ lookup('location.site') }}",
+				"rack":    "{{ lookup('location.racks.1') }}",
+				"missing": "{{ lookup('location.dc', 'none') }}",
+				"role":    "{{ lookup('role') }}",
+				"domain":  "{{ lookup('networking.domain') }}",
+			},
+		}
+
+		res, err := Resolve(root, map[string]any{"role": "WEB", "networking": map[string]any{"domain": "example.net"}}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"site": "lon", "rack": "r2", "missing": "none", "role": "web", "domain": "example.net"}))
+	})
+
+	It("Should order facts deterministically", func() {
+		derived, err := compileDerivedFacts(map[string]any{
+			"c": "{{ b + a }}",
+			"b": "{{ a }}",
+			"a": "1",
+			"d": "static",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var names []string
+		for _, fact := range derived {
+			names = append(names, fact.name)
+		}
+		Expect(names).To(Equal([]string{"a", "b", "c", "d"}))
+	})
+
+	It("Should detect circular references", func() {
+		_, err := compileDerivedFacts(map[string]any{
+			"a": "{{ lookup('b.x') }}",
+			"b": map[string]any{"x": "{{ c }}"},
+			"c": "{{ a }}",
+		})
+		Expect(err).To(MatchError("circular fact reference: a -> b -> c -> a"))
+	})
+
+	It("Should reject invalid facts", func() {
+		_, err := compileDerivedFacts([]any{"a"})
+		Expect(err).To(MatchError("facts must be a map"))
+
+		_, err = compileDerivedFacts(map[string]any{"a": "{{ data('x') }}"})
+		Expect(err).To(MatchError("facts.a: derived facts can not use data()"))
+
+		_, err = compileDerivedFacts(map[string]any{"a": "{{ 1 + }}"})
+		Expect(err).To(MatchError(HavePrefix("facts.a: expr compile error")))
+	})
+
+	It("Should report evaluation errors", func() {
+		r, err := New(map[string]any{
+			"facts":     map[string]any{"port": "{{ int(port) }}"},
+			"hierarchy": map[string]any{"order": []any{"default"}},
+		}, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.Resolve(context.Background(), map[string]any{"port": "http"})
+		Expect(err).To(MatchError(HavePrefix("facts.port: ")))
+	})
+})
@@ -0,0 +1,232 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// DefaultFactsCacheTTL is how long cached facts are used when no TTL is given to CachedFacts
+const DefaultFactsCacheTTL = 5 * time.Minute
+
+// GroupedFactProvider is a fact provider that can gather a subset of its facts, every top level key is a group
+type GroupedFactProvider interface {
+	FactProvider
+	// Groups lists the groups the provider gathers
+	Groups() []string
+	// GroupFacts gathers only the facts in groups
+	GroupFacts(ctx context.Context, groups []string) (map[string]any, error)
+}
+
+// FactCache configures caching of facts on disk
+type FactCache struct {
+	// Path is the file holding the cached facts, its directory is created when needed
+	Path string
+	// TTL is how long cached facts are used, DefaultFactsCacheTTL when 0
+	TTL time.Duration
+	// GroupTTL overrides TTL for specific groups
+	GroupTTL map[string]time.Duration
+	// Refresh ignores cached facts, fresh facts are still written to the cache
+	Refresh bool
+}
+
+type factCacheFile struct {
+	Provider string                    `json:"provider"`
+	Groups   map[string]factCacheGroup `json:"groups"`
+}
+
+type factCacheGroup struct {
+	Time  time.Time `json:"time"`
+	Facts any       `json:"facts"`
+}
+
+type cachedFacts struct {
+	provider FactProvider
+	cache    FactCache
+	now      func() time.Time
+}
+
+// CachedFacts wraps provider so its facts are cached on disk for use by later processes.
+//
+// Every top level key of the facts is a group with its own TTL, when provider is a GroupedFactProvider only expired
+// groups are gathered again otherwise all facts are gathered once any group expires. Failures to read or write the
+// cache are ignored and facts are gathered as if there was no cache.
+func CachedFacts(provider FactProvider, cache FactCache) FactProvider {
+	if cache.TTL <= 0 {
+		cache.TTL = DefaultFactsCacheTTL
+	}
+
+	return &cachedFacts{provider: provider, cache: cache, now: time.Now}
+}
+
+func (c *cachedFacts) Name() string { return c.provider.Name() }
+
+func (c *cachedFacts) Facts(ctx context.Context) (map[string]any, error) {
+	now := c.now()
+	cached := c.read()
+
+	grouped, isGrouped := c.provider.(GroupedFactProvider)
+
+	var groups []string
+	if isGrouped {
+		groups = grouped.Groups()
+	} else {
+		groups = slices.Collect(maps.Keys(cached.Groups))
+	}
+
+	var expired []string
+	for _, group := range groups {
+		if !c.fresh(cached, group, now) {
+			expired = append(expired, group)
+		}
+	}
+
+	switch {
+	case isGrouped && len(expired) > 0:
+		facts, err := grouped.GroupFacts(ctx, expired)
+		if err != nil {
+			return nil, err
+		}
+
+		err = c.update(cached, facts, now)
+		if err != nil {
+			return nil, err
+		}
+
+	case !isGrouped && (len(groups) == 0 || len(expired) > 0):
+		facts, err := c.provider.Facts(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cached.Groups = map[string]factCacheGroup{}
+		err = c.update(cached, facts, now)
+		if err != nil {
+			return nil, err
+		}
+		groups = slices.Collect(maps.Keys(facts))
+	}
+
+	// the cache may hold groups written by other processes that the provider does not gather
+	facts := make(map[string]any, len(groups))
+	for _, group := range groups {
+		if entry, ok := cached.Groups[group]; ok {
+			facts[group] = entry.Facts
+		}
+	}
+
+	return facts, nil
+}
+
+// fresh determines if group is cached and not expired, nothing is fresh when refreshing
+func (c *cachedFacts) fresh(cached *factCacheFile, group string, now time.Time) bool {
+	if c.cache.Refresh {
+		return false
+	}
+
+	entry, ok := cached.Groups[group]
+	if !ok {
+		return false
+	}
+
+	ttl, ok := c.cache.GroupTTL[group]
+	if !ok || ttl <= 0 {
+		ttl = c.cache.TTL
+	}
+
+	return now.Sub(entry.Time) < ttl
+}
+
+// read loads the cache, a missing or unreadable cache and one written for another provider is empty
+func (c *cachedFacts) read() *factCacheFile {
+	empty := &factCacheFile{Provider: c.provider.Name(), Groups: map[string]factCacheGroup{}}
+
+	data, err := os.ReadFile(c.cache.Path)
+	if err != nil {
+		return empty
+	}
+
+	cached := &factCacheFile{}
+	err = decodeCachedFacts(data, cached)
+	if err != nil || cached.Provider != c.provider.Name() || cached.Groups == nil {
+		return empty
+	}
+
+	for group, entry := range cached.Groups {
+		entry.Facts = normalizeNumericValues(entry.Facts)
+		cached.Groups[group] = entry
+	}
+
+	return cached
+}
+
+// update stores facts in cached and writes the cache, facts are stored as they would be read from the cache so they
+// have the same types whether they were cached or not
+func (c *cachedFacts) update(cached *factCacheFile, facts map[string]any, now time.Time) error {
+	for group, value := range facts {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", group, err)
+		}
+
+		var stored any
+		err = decodeCachedFacts(data, &stored)
+		if err != nil {
+			return fmt.Errorf("%s: %w", group, err)
+		}
+
+		cached.Groups[group] = factCacheGroup{Time: now, Facts: normalizeNumericValues(stored)}
+	}
+
+	c.write(cached)
+
+	return nil
+}
+
+// decodeCachedFacts decodes JSON keeping numbers as json.Number so integers survive normalizeNumericValues exactly
+func decodeCachedFacts(data []byte, target any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	return dec.Decode(target)
+}
+
+// write saves the cache using a temporary file so other processes never read a partial cache
+func (c *cachedFacts) write(cached *factCacheFile) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Dir(c.cache.Path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return
+	}
+
+	tf, err := os.CreateTemp(dir, filepath.Base(c.cache.Path)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tf.Name())
+
+	_, err = tf.Write(data)
+	if cerr := tf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+
+	os.Rename(tf.Name(), c.cache.Path)
+}
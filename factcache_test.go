@@ -0,0 +1,207 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type countingFacts struct {
+	groups   []string
+	gathered [][]string
+	err      error
+}
+
+func (p *countingFacts) Name() string { return "counting" }
+
+func (p *countingFacts) Groups() []string { return p.groups }
+
+func (p *countingFacts) Facts(ctx context.Context) (map[string]any, error) {
+	return p.GroupFacts(ctx, p.Groups())
+}
+
+func (p *countingFacts) GroupFacts(_ context.Context, groups []string) (map[string]any, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	p.gathered = append(p.gathered, groups)
+
+	facts := map[string]any{}
+	for _, group := range groups {
+		facts[group] = map[string]any{"count": len(p.gathered)}
+	}
+
+	return facts, nil
+}
+
+var _ = Describe("CachedFacts", func() {
+	var (
+		path     string
+		now      time.Time
+		provider *countingFacts
+	)
+
+	cached := func(cache FactCache, p FactProvider) FactProvider {
+		cache.Path = path
+		cf := CachedFacts(p, cache).(*cachedFacts)
+		cf.now = func() time.Time { return now }
+		return cf
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "cache", "facts.json")
+		now = time.Now()
+		provider = &countingFacts{groups: []string{"memory", "partitions"}}
+	})
+
+	It("Should use cached facts until they expire", func() {
+		cf := cached(FactCache{TTL: time.Minute}, provider)
+		Expect(cf.Name()).To(Equal("counting"))
+
+		facts, err := cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{
+			"memory":     map[string]any{"count": 1},
+			"partitions": map[string]any{"count": 1},
+		}))
+		Expect(path).To(BeARegularFile())
+
+		now = now.Add(30 * time.Second)
+		facts, err = cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts["memory"]).To(Equal(map[string]any{"count": 1}))
+		Expect(provider.gathered).To(HaveLen(1))
+
+		now = now.Add(time.Minute)
+		facts, err = cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts["memory"]).To(Equal(map[string]any{"count": 2}))
+		Expect(provider.gathered).To(Equal([][]string{{"memory", "partitions"}, {"memory", "partitions"}}))
+	})
+
+	It("Should only gather expired groups", func() {
+		cf := cached(FactCache{TTL: time.Minute, GroupTTL: map[string]time.Duration{"partitions": time.Hour}}, provider)
+
+		_, err := cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		now = now.Add(2 * time.Minute)
+		facts, err := cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{
+			"memory":     map[string]any{"count": 2},
+			"partitions": map[string]any{"count": 1},
+		}))
+		Expect(provider.gathered).To(Equal([][]string{{"memory", "partitions"}, {"memory"}}))
+	})
+
+	It("Should only return the groups the provider gathers", func() {
+		_, err := cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		provider.groups = []string{"memory"}
+		facts, err := cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{"memory": map[string]any{"count": 1}}))
+		Expect(provider.gathered).To(HaveLen(1))
+	})
+
+	It("Should gather all facts when refreshing", func() {
+		_, err := cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		facts, err := cached(FactCache{Refresh: true}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts["partitions"]).To(Equal(map[string]any{"count": 2}))
+
+		facts, err = cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts["partitions"]).To(Equal(map[string]any{"count": 2}))
+		Expect(provider.gathered).To(HaveLen(2))
+	})
+
+	It("Should cache providers that can not gather groups", func() {
+		calls := 0
+		p := FactsFunc("plain", func(context.Context) (map[string]any, error) {
+			calls++
+			return map[string]any{"memory": calls, "cpu": calls}, nil
+		})
+
+		cf := cached(FactCache{GroupTTL: map[string]time.Duration{"cpu": time.Second}}, p)
+		_, err := cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		facts, err := cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{"memory": 1, "cpu": 1}))
+
+		now = now.Add(2 * time.Second)
+		facts, err = cf.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{"memory": 2, "cpu": 2}))
+	})
+
+	It("Should keep integer facts exact", func() {
+		p := FactsFunc("plain", func(context.Context) (map[string]any, error) {
+			return map[string]any{
+				"memory": map[string]any{"total_bytes": uint64(1<<62 + 1)},
+				"cpu":    map[string]any{"count": 8, "load": 1.5, "max": uint64(math.MaxUint64)},
+			}, nil
+		})
+
+		expected := map[string]any{
+			"memory": map[string]any{"total_bytes": 1<<62 + 1},
+			"cpu":    map[string]any{"count": 8, "load": 1.5, "max": uint64(math.MaxUint64)},
+		}
+
+		facts, err := cached(FactCache{}, p).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(expected))
+
+		facts, err = cached(FactCache{}, p).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(expected))
+	})
+
+	It("Should ignore caches written by other providers or that are corrupt", func() {
+		_, err := cached(FactCache{}, FactsFunc("other", func(context.Context) (map[string]any, error) {
+			return map[string]any{"memory": "other"}, nil
+		})).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		facts, err := cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts["memory"]).To(Equal(map[string]any{"count": 1}))
+
+		Expect(os.WriteFile(path, []byte("{"), 0600)).To(Succeed())
+		_, err = cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provider.gathered).To(HaveLen(2))
+	})
+
+	It("Should gather facts when the cache can not be written", func() {
+		path = filepath.Join("/dev/null", "facts.json")
+
+		facts, err := cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts["memory"]).To(Equal(map[string]any{"count": 1}))
+	})
+
+	It("Should not cache failures", func() {
+		provider.err = errors.New("failed")
+		_, err := cached(FactCache{}, provider).Facts(context.Background())
+		Expect(err).To(MatchError("failed"))
+		Expect(path).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,381 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/choria-io/tinyhiera/internal"
+	"github.com/goccy/go-yaml"
+)
+
+// FactProvider supplies facts about the node data is resolved for
+type FactProvider interface {
+	// Name is a short unique name for the provider used in errors
+	Name() string
+	// Facts gathers the facts
+	Facts(ctx context.Context) (map[string]any, error)
+}
+
+// FactError reports a fact provider that failed to gather facts
+type FactError struct {
+	// Provider is the name of the failed provider
+	Provider string
+	// Err is the error the provider returned
+	Err error
+}
+
+func (e *FactError) Error() string {
+	return fmt.Sprintf("%s facts: %v", e.Provider, e.Err)
+}
+
+func (e *FactError) Unwrap() error {
+	return e.Err
+}
+
+// FactRegistry composes facts from many providers, providers registered later take precedence over earlier ones
+type FactRegistry struct {
+	entries []factEntry
+}
+
+type factEntry struct {
+	provider  FactProvider
+	namespace string
+}
+
+// NewFactRegistry creates an empty fact registry
+func NewFactRegistry() *FactRegistry {
+	return &FactRegistry{}
+}
+
+// Register adds a provider to the registry. Its facts are deep merged into those of earlier providers, when namespace
+// is not empty they are placed under that key instead
+func (r *FactRegistry) Register(provider FactProvider, namespace string) error {
+	if slices.ContainsFunc(r.entries, func(e factEntry) bool { return e.provider.Name() == provider.Name() }) {
+		return fmt.Errorf("fact provider %s is already registered", provider.Name())
+	}
+
+	r.entries = append(r.entries, factEntry{provider: provider, namespace: namespace})
+
+	return nil
+}
+
+// Providers lists the names of the registered providers in order of precedence, lowest first
+func (r *FactRegistry) Providers() []string {
+	names := make([]string, len(r.entries))
+	for i, entry := range r.entries {
+		names[i] = entry.provider.Name()
+	}
+
+	return names
+}
+
+// Facts gathers facts from every provider in order, failures are reported as *FactError and multiple errors are joined
+func (r *FactRegistry) Facts(ctx context.Context) (map[string]any, error) {
+	facts := map[string]any{}
+	merger := newMerger(nil, ArrayReplace, "")
+
+	var errs []error
+	for _, entry := range r.entries {
+		pf, err := entry.provider.Facts(ctx)
+		if err != nil {
+			errs = append(errs, &FactError{Provider: entry.provider.Name(), Err: err})
+			continue
+		}
+
+		if entry.namespace != "" {
+			pf = map[string]any{entry.namespace: pf}
+		}
+
+		facts = merger.deepMerge(facts, pf)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return facts, nil
+}
+
+type funcFacts struct {
+	name string
+	fn   func(ctx context.Context) (map[string]any, error)
+}
+
+func (p *funcFacts) Name() string { return p.name }
+
+func (p *funcFacts) Facts(ctx context.Context) (map[string]any, error) { return p.fn(ctx) }
+
+// FactsFunc creates a fact provider that calls fn to gather facts
+func FactsFunc(name string, fn func(ctx context.Context) (map[string]any, error)) FactProvider {
+	return &funcFacts{name: name, fn: fn}
+}
+
+// StaticFacts creates a fact provider that supplies a copy of facts
+func StaticFacts(name string, facts map[string]any) FactProvider {
+	return FactsFunc(name, func(context.Context) (map[string]any, error) {
+		return cloneMap(facts), nil
+	})
+}
+
+type systemFacts struct {
+	groups  []string
+	timeout time.Duration
+}
+
+func (p *systemFacts) Name() string { return "system" }
+
+func (p *systemFacts) Groups() []string { return slices.Clone(p.groups) }
+
+func (p *systemFacts) Facts(ctx context.Context) (map[string]any, error) {
+	return p.GroupFacts(ctx, p.groups)
+}
+
+func (p *systemFacts) GroupFacts(ctx context.Context, groups []string) (map[string]any, error) {
+	return internal.GroupFacts(ctx, p.timeout, groups...)
+}
+
+// DefaultFactGroupTimeout is how long a group of system facts may take to gather when no timeout is given
+const DefaultFactGroupTimeout = 10 * time.Second
+
+// SystemFactsOptions selects the facts gathered by a system fact provider
+type SystemFactsOptions struct {
+	// Groups are the groups of facts to gather, all groups are gathered when empty
+	Groups []string
+	// Exclude are groups of facts not to gather
+	Exclude []string
+	// Timeout is how long a group may take to gather, DefaultFactGroupTimeout when 0. Groups that take longer are left out
+	Timeout time.Duration
+}
+
+// SystemFactGroups lists the groups of facts a system fact provider can gather
+func SystemFactGroups() []string {
+	return slices.Clone(internal.FactGroups)
+}
+
+// SystemFacts creates a fact provider named system that gathers all facts about the host, see SystemFactsSchema for
+// details.
+//
+// The provider is a GroupedFactProvider with the groups listed by SystemFactGroups
+func SystemFacts() FactProvider {
+	return &systemFacts{groups: SystemFactGroups(), timeout: DefaultFactGroupTimeout}
+}
+
+// SelectSystemFacts creates a fact provider like SystemFacts that only gathers the groups selected in opts
+func SelectSystemFacts(opts SystemFactsOptions) (FactProvider, error) {
+	for _, group := range slices.Concat(opts.Groups, opts.Exclude) {
+		if !slices.Contains(internal.FactGroups, group) {
+			return nil, fmt.Errorf("unknown system fact group %q, valid groups are %s", group, strings.Join(internal.FactGroups, ", "))
+		}
+	}
+
+	groups := opts.Groups
+	if len(groups) == 0 {
+		groups = internal.FactGroups
+	}
+
+	provider := &systemFacts{timeout: opts.Timeout}
+	for _, group := range groups {
+		if !slices.Contains(opts.Exclude, group) && !slices.Contains(provider.groups, group) {
+			provider.groups = append(provider.groups, group)
+		}
+	}
+
+	if provider.timeout <= 0 {
+		provider.timeout = DefaultFactGroupTimeout
+	}
+
+	return provider, nil
+}
+
+// SystemFactsSchema describes the facts gathered by SystemFacts as a JSON Schema.
+//
+// The schema is versioned, the version is increased whenever facts are renamed or removed.
+func SystemFactsSchema() map[string]any {
+	return internal.FactsSchema()
+}
+
+// EnvFacts creates a fact provider named env that supplies every variable in the process environment
+func EnvFacts() FactProvider {
+	return FactsFunc("env", func(context.Context) (map[string]any, error) {
+		facts := map[string]any{}
+		for _, v := range os.Environ() {
+			key, value, _ := strings.Cut(v, "=")
+			facts[key] = value
+		}
+
+		return facts, nil
+	})
+}
+
+// PrefixedEnvFacts creates a fact provider named env that supplies the variables in the process environment starting
+// with prefix.
+//
+// The prefix is removed and names are lower cased with __ separating nested facts, FACT_WEB__PORT=80 becomes web.port
+// when the prefix is FACT_. When a name is both a value and holds nested facts the nested facts are kept. With coerce
+// numbers, true, false and JSON objects and arrays become values of their type.
+func PrefixedEnvFacts(prefix string, coerce bool) FactProvider {
+	return FactsFunc("env", func(context.Context) (map[string]any, error) {
+		vars := os.Environ()
+		slices.Sort(vars)
+
+		facts := map[string]any{}
+		for _, v := range vars {
+			key, value, _ := strings.Cut(v, "=")
+
+			name, ok := strings.CutPrefix(key, prefix)
+			if !ok {
+				continue
+			}
+
+			path := strings.Split(strings.ToLower(name), "__")
+			if slices.Contains(path, "") {
+				continue
+			}
+
+			var fact any = value
+			if coerce {
+				fact = coerceFact(value)
+			}
+
+			setFact(facts, path, fact)
+		}
+
+		return facts, nil
+	})
+}
+
+// setFact stores value at path in facts, maps along path replace other values and existing maps at path are kept
+func setFact(facts map[string]any, path []string, value any) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := facts[key].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			facts[key] = child
+		}
+		facts = child
+	}
+
+	key := path[len(path)-1]
+	if _, ok := facts[key].(map[string]any); ok {
+		return
+	}
+
+	facts[key] = value
+}
+
+// coerceFact converts value into an integer, float, boolean or the JSON object or array it holds, other values and
+// numbers with leading zeros, like zip codes and file modes, are kept as strings
+func coerceFact(value string) any {
+	digits := strings.TrimPrefix(value, "-")
+
+	switch {
+	case value == "true" || value == "false":
+		return value == "true"
+
+	case strings.HasPrefix(value, "{") || strings.HasPrefix(value, "["):
+		if parsed, ok := jsonFact(value); ok {
+			return parsed
+		}
+
+	case len(digits) > 1 && digits[0] == '0' && digits[1] != '.':
+		return value
+
+	default:
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return f
+		}
+	}
+
+	return value
+}
+
+// jsonFact parses value when it holds a JSON object or array
+func jsonFact(value string) (any, bool) {
+	if !strings.HasPrefix(value, "{") && !strings.HasPrefix(value, "[") {
+		return nil, false
+	}
+
+	var parsed any
+	if json.Unmarshal([]byte(value), &parsed) != nil {
+		return nil, false
+	}
+
+	return parsed, true
+}
+
+// ParseFactArgs parses key=value arguments, like those given on the command line, into facts.
+//
+// Dotted keys like networking.fqdn=example.net create nested facts and values holding JSON objects or arrays are
+// parsed. With infer numbers, true and false also become values of their type. Arguments are handled in order and
+// when a key is both a value and holds nested facts the nested facts are kept.
+func ParseFactArgs(args []string, infer bool) (map[string]any, error) {
+	facts := map[string]any{}
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid fact %q, expected key=value", arg)
+		}
+
+		path := strings.Split(key, ".")
+		if slices.Contains(path, "") {
+			return nil, fmt.Errorf("invalid fact key %q", key)
+		}
+
+		var fact any = value
+		if infer {
+			fact = coerceFact(value)
+		} else if parsed, ok := jsonFact(value); ok {
+			fact = parsed
+		}
+
+		setFact(facts, path, fact)
+	}
+
+	return facts, nil
+}
+
+// FileFacts creates a fact provider named file:path that reads facts from a JSON or YAML file
+func FileFacts(path string) FactProvider {
+	return FactsFunc("file:"+path, func(context.Context) (map[string]any, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseFacts(data)
+	})
+}
+
+// parseFacts parses a JSON or YAML document holding facts
+func parseFacts(data []byte) (map[string]any, error) {
+	facts := map[string]any{}
+
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &facts)
+	} else {
+		err = yaml.Unmarshal(data, &facts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return facts, nil
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Facts", func() {
+	Describe("FactRegistry", func() {
+		It("Should merge providers in order of precedence", func() {
+			registry := NewFactRegistry()
+			Expect(registry.Register(StaticFacts("base", map[string]any{"env": "dev", "web": map[string]any{"port": 80, "tls": false}, "tags": []any{"a"}}), "")).To(Succeed())
+			Expect(registry.Register(StaticFacts("node", map[string]any{"env": "prod", "web": map[string]any{"port": 443}, "tags": []any{"b"}}), "")).To(Succeed())
+			Expect(registry.Register(StaticFacts("extra", map[string]any{"region": "eu"}), "custom")).To(Succeed())
+
+			Expect(registry.Providers()).To(Equal([]string{"base", "node", "extra"}))
+
+			facts, err := registry.Facts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]any{
+				"env":    "prod",
+				"web":    map[string]any{"port": 443, "tls": false},
+				"tags":   []any{"b"},
+				"custom": map[string]any{"region": "eu"},
+			}))
+		})
+
+		It("Should reject duplicate providers", func() {
+			registry := NewFactRegistry()
+			Expect(registry.Register(StaticFacts("base", nil), "")).To(Succeed())
+			Expect(registry.Register(StaticFacts("base", nil), "")).To(MatchError("fact provider base is already registered"))
+		})
+
+		It("Should attribute errors to providers", func() {
+			registry := NewFactRegistry()
+			Expect(registry.Register(FactsFunc("broken", func(context.Context) (map[string]any, error) {
+				return nil, errors.New("failed")
+			}), "")).To(Succeed())
+			Expect(registry.Register(FileFacts("/nonexisting"), "")).To(Succeed())
+
+			_, err := registry.Facts(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("broken facts: failed")))
+			Expect(err).To(MatchError(ContainSubstring("file:/nonexisting facts: open /nonexisting")))
+
+			var fe *FactError
+			Expect(errors.As(err, &fe)).To(BeTrue())
+			Expect(fe.Provider).To(Equal("broken"))
+		})
+	})
+
+	Describe("Providers", func() {
+		It("Should select system fact groups", func() {
+			provider, err := SelectSystemFacts(SystemFactsOptions{Groups: []string{"kernel", "os", "partitions", "kernel"}, Exclude: []string{"partitions"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(provider.(GroupedFactProvider).Groups()).To(Equal([]string{"kernel", "os"}))
+
+			facts, err := provider.Facts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(HaveLen(2))
+			Expect(facts).To(HaveKey("kernel"))
+			Expect(facts).To(HaveKey("os"))
+
+			provider, err = SelectSystemFacts(SystemFactsOptions{Exclude: []string{"partitions", "dmi"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(provider.(GroupedFactProvider).Groups()).To(Equal([]string{"memory", "cpu", "host", "kernel", "os", "networking", "container"}))
+
+			_, err = SelectSystemFacts(SystemFactsOptions{Exclude: []string{"network"}})
+			Expect(err).To(MatchError(`unknown system fact group "network", valid groups are memory, cpu, partitions, host, kernel, os, networking, dmi, container`))
+		})
+
+		It("Should gather system fact groups", func() {
+			grouped, ok := SystemFacts().(GroupedFactProvider)
+			Expect(ok).To(BeTrue())
+			Expect(grouped.Groups()).To(ContainElements("memory", "partitions", "networking"))
+
+			facts, err := grouped.GroupFacts(context.Background(), []string{"kernel"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(HaveLen(1))
+			Expect(facts).To(HaveKey("kernel"))
+		})
+
+		It("Should read JSON and YAML files", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "facts.json"), []byte(`{"env":"prod"}`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "facts.yaml"), []byte("env: dev\n"), 0600)).To(Succeed())
+
+			facts, err := FileFacts(filepath.Join(dir, "facts.json")).Facts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]any{"env": "prod"}))
+
+			facts, err = FileFacts(filepath.Join(dir, "facts.yaml")).Facts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]any{"env": "dev"}))
+		})
+
+		It("Should read the environment", func() {
+			GinkgoT().Setenv("TINYHIERA_TEST", "a=b")
+
+			facts, err := EnvFacts().Facts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(HaveKeyWithValue("TINYHIERA_TEST", "a=b"))
+		})
+
+		It("Should nest prefixed environment variables", func() {
+			GinkgoT().Setenv("TINYHIERA_FACT_WEB__PORT", "80")
+			GinkgoT().Setenv("TINYHIERA_FACT_WEB__TLS", "true")
+			GinkgoT().Setenv("TINYHIERA_FACT_WEB", "shadowed")
+			GinkgoT().Setenv("TINYHIERA_FACT_ROLE", "web=frontend")
+			GinkgoT().Setenv("TINYHIERA_FACT_TAGS", `["a","b"]`)
+			GinkgoT().Setenv("TINYHIERA_FACT_BAD__", "skipped")
+
+			facts, err := PrefixedEnvFacts("TINYHIERA_FACT_", false).Facts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]any{
+				"web":  map[string]any{"port": "80", "tls": "true"},
+				"role": "web=frontend",
+				"tags": `["a","b"]`,
+			}))
+
+			facts, err = PrefixedEnvFacts("TINYHIERA_FACT_", true).Facts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]any{
+				"web":  map[string]any{"port": 80, "tls": true},
+				"role": "web=frontend",
+				"tags": []any{"a", "b"},
+			}))
+		})
+
+		It("Should parse fact arguments", func() {
+			facts, err := ParseFactArgs([]string{"networking.fqdn=web01.example.net", "port=80", "tags=[\"a\",\"b\"]", "tls=true", "query=a=b", "networking.domain=example.net"}, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]any{
+				"networking": map[string]any{"fqdn": "web01.example.net", "domain": "example.net"},
+				"port":       "80",
+				"tags":       []any{"a", "b"},
+				"tls":        "true",
+				"query":      "a=b",
+			}))
+
+			facts, err = ParseFactArgs([]string{"port=80", "tls=true", "zip=01234", "web=x", "web.port=443"}, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]any{
+				"port": 80,
+				"tls":  true,
+				"zip":  "01234",
+				"web":  map[string]any{"port": 443},
+			}))
+
+			_, err = ParseFactArgs([]string{"port"}, false)
+			Expect(err).To(MatchError(`invalid fact "port", expected key=value`))
+			_, err = ParseFactArgs([]string{"web..port=1"}, false)
+			Expect(err).To(MatchError(`invalid fact key "web..port"`))
+		})
+
+		It("Should coerce values", func() {
+			Expect(coerceFact("10")).To(Equal(10))
+			Expect(coerceFact("-10")).To(Equal(-10))
+			Expect(coerceFact("0")).To(Equal(0))
+			Expect(coerceFact("1.5")).To(Equal(1.5))
+			Expect(coerceFact("0.5")).To(Equal(0.5))
+			Expect(coerceFact("true")).To(BeTrue())
+			Expect(coerceFact("false")).To(BeFalse())
+			Expect(coerceFact(`{"a":1}`)).To(Equal(map[string]any{"a": float64(1)}))
+			Expect(coerceFact("0755")).To(Equal("0755"))
+			Expect(coerceFact("01234")).To(Equal("01234"))
+			Expect(coerceFact("{not json")).To(Equal("{not json"))
+			Expect(coerceFact("NaN")).To(Equal("NaN"))
+			Expect(coerceFact("Inf")).To(Equal("Inf"))
+			Expect(coerceFact("yes")).To(Equal("yes"))
+			Expect(coerceFact("")).To(Equal(""))
+		})
+	})
+})
@@ -0,0 +1,167 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultFactsTimeout is how long a fact executable may run when no timeout is given to DirFacts
+const DefaultFactsTimeout = 10 * time.Second
+
+// executableWaitDelay is how long output of a killed fact executable is waited for
+const executableWaitDelay = 100 * time.Millisecond
+
+// DirFacts creates a fact provider named dir:path that gathers facts from the files in a directory, like facter.d.
+//
+// Files ending in .json, .yaml or .yml are parsed as documents and .txt files hold key=value lines. Executable files
+// are run and their output is parsed as JSON, YAML or key=value lines, each may run for timeout or DefaultFactsTimeout
+// when it is 0. Files are processed in name order with later files taking precedence, hidden files are ignored.
+func DirFacts(dir string, timeout time.Duration) FactProvider {
+	if timeout <= 0 {
+		timeout = DefaultFactsTimeout
+	}
+
+	return FactsFunc("dir:"+dir, func(ctx context.Context) (map[string]any, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		facts := map[string]any{}
+		merger := newMerger(nil, ArrayReplace, "")
+
+		var errs []error
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+				continue
+			}
+
+			ff, err := readFactsFile(ctx, filepath.Join(dir, entry.Name()), timeout)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+				continue
+			}
+
+			facts = merger.deepMerge(facts, ff)
+		}
+
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+
+		return facts, nil
+	})
+}
+
+// readFactsFile reads facts from a single file in a facts directory, files that are not facts return no facts
+func readFactsFile(ctx context.Context, path string, timeout time.Duration) (map[string]any, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !stat.Mode().IsRegular() {
+		return map[string]any{}, nil
+	}
+
+	if stat.Mode().Perm()&0111 != 0 {
+		return runFactsExecutable(ctx, path, timeout)
+	}
+
+	switch filepath.Ext(path) {
+	case ".json", ".yaml", ".yml":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return parseFacts(data)
+
+	case ".txt":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		facts, ok := parseKeyValueFacts(data)
+		if !ok {
+			return nil, fmt.Errorf("invalid key=value facts")
+		}
+		return facts, nil
+
+	default:
+		return map[string]any{}, nil
+	}
+}
+
+// runFactsExecutable runs path and parses its output as JSON, YAML or key=value lines
+func runFactsExecutable(ctx context.Context, path string, timeout time.Duration) (map[string]any, error) {
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(tctx, path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// children of the executable can hold its output open after it was killed
+	cmd.WaitDelay = executableWaitDelay
+	killProcessGroup(cmd)
+
+	err := cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case tctx.Err() != nil:
+		return nil, fmt.Errorf("did not complete within %v", timeout)
+	case err != nil:
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", err, msg)
+	}
+
+	if facts, ok := parseKeyValueFacts(stdout.Bytes()); ok {
+		return facts, nil
+	}
+
+	return parseFacts(stdout.Bytes())
+}
+
+// parseKeyValueFacts parses key=value lines, empty lines and lines starting with # are ignored. It fails when any
+// line is not a key=value pair so other formats can be tried
+func parseKeyValueFacts(data []byte) (map[string]any, bool) {
+	facts := map[string]any{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " :{}[]\"") {
+			return nil, false
+		}
+
+		facts[key] = strings.TrimSpace(value)
+	}
+
+	if scanner.Err() != nil {
+		return nil, false
+	}
+
+	return facts, true
+}
@@ -0,0 +1,14 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !unix
+
+package tinyhiera
+
+import (
+	"os/exec"
+)
+
+// killProcessGroup is not supported on this platform, cmd.WaitDelay still bounds how long children are waited for
+func killProcessGroup(_ *exec.Cmd) {}
@@ -0,0 +1,97 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DirFacts", func() {
+	var dir string
+
+	write := func(name string, content string, mode os.FileMode) {
+		Expect(os.WriteFile(filepath.Join(dir, name), []byte(content), mode)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("Should read files and run executables in name order", func() {
+		write("10-base.yaml", "env: dev\nweb:\n  port: 80\n  tls: false\n", 0644)
+		write("20-node.json", `{"env": "prod", "web": {"port": 443}}`, 0644)
+		write("30-extra.txt", "# a comment\nrack = r1\nurl=http://x/?a=b\n", 0644)
+		write("40-exec.sh", "#!/bin/sh\necho '{\"role\": \"web\"}'\n", 0755)
+		write("50-exec-kv", "#!/bin/sh\necho zone=eu\n", 0755)
+		write("60-exec-yaml", "#!/bin/sh\necho 'tags: [a, b]'\n", 0755)
+		write("README.md", "not facts", 0644)
+		write(".hidden.yaml", "hidden: true", 0644)
+		Expect(os.Mkdir(filepath.Join(dir, "sub.json"), 0755)).To(Succeed())
+
+		facts, err := DirFacts(dir, 0).Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{
+			"env":  "prod",
+			"web":  map[string]any{"port": float64(443), "tls": false},
+			"rack": "r1",
+			"url":  "http://x/?a=b",
+			"role": "web",
+			"zone": "eu",
+			"tags": []any{"a", "b"},
+		}))
+	})
+
+	It("Should report failures by file", func() {
+		write("bad.txt", "not key value\n", 0644)
+		write("fail.sh", "#!/bin/sh\necho oops >&2\nexit 1\n", 0755)
+		write("slow.sh", "#!/bin/sh\nexec sleep 5\n", 0755)
+
+		start := time.Now()
+		_, err := DirFacts(dir, 200*time.Millisecond).Facts(context.Background())
+		Expect(time.Since(start)).To(BeNumerically("<", 4*time.Second))
+		Expect(err).To(MatchError(ContainSubstring("bad.txt: invalid key=value facts")))
+		Expect(err).To(MatchError(ContainSubstring("fail.sh: exit status 1: oops")))
+		Expect(err).To(MatchError(ContainSubstring("slow.sh: did not complete within 200ms")))
+	})
+
+	It("Should enforce the timeout when children hold the output open", func() {
+		write("slow.sh", "#!/bin/sh\nsleep 6\necho a=b\n", 0755)
+
+		start := time.Now()
+		_, err := DirFacts(dir, 200*time.Millisecond).Facts(context.Background())
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		Expect(err).To(MatchError("slow.sh: did not complete within 200ms"))
+	})
+
+	It("Should report cancellation of the parent context", func() {
+		write("slow.sh", "#!/bin/sh\nsleep 6\necho a=b\n", 0755)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := DirFacts(dir, time.Minute).Facts(ctx)
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("Should be usable in a registry", func() {
+		write("facts.yaml", "env: prod\n", 0644)
+
+		registry := NewFactRegistry()
+		Expect(registry.Register(DirFacts(dir, time.Second), "")).To(Succeed())
+		Expect(registry.Providers()).To(Equal([]string{"dir:" + dir}))
+
+		facts, err := registry.Facts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{"env": "prod"}))
+	})
+})
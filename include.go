@@ -0,0 +1,266 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DocumentFiles are the names tried, in order, for the main document when loading a directory
+var DocumentFiles = []string{"hiera.yaml", "hiera.yml", "hiera.json"}
+
+// OverridesDir is the directory holding one file per override when loading a directory
+const OverridesDir = "overrides"
+
+// Load reads a document and everything it imports from fsys using LoadDocument and compiles it using New
+func Load(fsys fs.FS, name string, opts Options) (*Resolver, error) {
+	root, err := LoadDocument(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(root, opts)
+}
+
+// LoadDocument reads the JSON or YAML document name from fsys and combines it with the documents listed in its imports
+// section into a single document. Imports are paths or globs relative to the importing document and can import others.
+//
+// Every section holding a map is combined key by key while other sections, and the hierarchy and schema, can only be
+// set in one document. Defining the same key in many documents is an error so the result does not depend on the order
+// of imports.
+//
+// When name is a directory the main document is the first of DocumentFiles found in it and every JSON or YAML file
+// below its overrides directory is an override named for its path without the extension, overrides/role/web.yaml
+// is the override role/web
+func LoadDocument(fsys fs.FS, name string) (map[string]any, error) {
+	l := &documentLoader{fsys: fsys, root: map[string]any{}, sources: map[string]string{}, loaded: map[string]bool{}}
+
+	stat, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !stat.IsDir() {
+		err = l.load(path.Clean(name))
+		if err != nil {
+			return nil, err
+		}
+
+		return l.root, nil
+	}
+
+	err = l.loadDir(path.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return l.root, nil
+}
+
+// documentLoader combines a document with its imports
+type documentLoader struct {
+	fsys fs.FS
+	// root is the combined document
+	root map[string]any
+	// sources records the document that set every section or key in root
+	sources map[string]string
+	// loaded is every document already combined into root
+	loaded map[string]bool
+	// stack is the chain of documents being imported used to detect circular imports
+	stack []string
+}
+
+// loadDir loads the main document in dir and every file in its overrides directory
+func (l *documentLoader) loadDir(dir string) error {
+	main := ""
+	for _, candidate := range DocumentFiles {
+		_, err := fs.Stat(l.fsys, path.Join(dir, candidate))
+		if err == nil {
+			main = path.Join(dir, candidate)
+			break
+		}
+	}
+	if main == "" {
+		return fmt.Errorf("%s: no %s found", dir, strings.Join(DocumentFiles, ", "))
+	}
+
+	err := l.load(main)
+	if err != nil {
+		return err
+	}
+
+	overrides := path.Join(dir, OverridesDir)
+	_, err = fs.Stat(l.fsys, overrides)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return fs.WalkDir(l.fsys, overrides, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		ext := path.Ext(name)
+		if entry.IsDir() || !slices.Contains([]string{".json", ".yaml", ".yml"}, ext) {
+			return nil
+		}
+
+		override, err := l.read(name)
+		if err != nil {
+			return err
+		}
+
+		key := strings.TrimSuffix(strings.TrimPrefix(name, overrides+"/"), ext)
+
+		return l.combine(name, map[string]any{"overrides": map[string]any{key: override}})
+	})
+}
+
+// load reads a document and everything it imports
+func (l *documentLoader) load(name string) error {
+	if start := slices.Index(l.stack, name); start >= 0 {
+		return fmt.Errorf("circular import: %s", strings.Join(append(slices.Clone(l.stack[start:]), name), " -> "))
+	}
+
+	if l.loaded[name] {
+		return nil
+	}
+
+	doc, err := l.read(name)
+	if err != nil {
+		return err
+	}
+
+	imports, err := documentImports(doc["imports"])
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	delete(doc, "imports")
+
+	l.loaded[name] = true
+	err = l.combine(name, doc)
+	if err != nil {
+		return err
+	}
+
+	l.stack = append(l.stack, name)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	for _, imp := range imports {
+		target := path.Join(path.Dir(name), imp)
+
+		matches := []string{target}
+		if strings.ContainsAny(imp, "*?[") {
+			matches, err = fs.Glob(l.fsys, target)
+			if err != nil {
+				return fmt.Errorf("%s: invalid import %s: %w", name, imp, err)
+			}
+		} else if _, err := fs.Stat(l.fsys, target); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s: imported document %s does not exist", name, target)
+		}
+
+		for _, match := range matches {
+			err = l.load(match)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// read parses a JSON or YAML file
+func (l *documentLoader) read(name string) (map[string]any, error) {
+	data, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseFacts(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return doc, nil
+}
+
+// combine adds the sections of doc, read from source, to the combined document
+func (l *documentLoader) combine(source string, doc map[string]any) error {
+	for _, section := range sortedKeys(doc) {
+		value := doc[section]
+		if value == nil {
+			continue
+		}
+
+		entries, combined := value.(map[string]any)
+		combined = combined && section != "hierarchy" && section != "schema"
+
+		prev, defined := l.sources[section]
+		existing, ok := l.root[section].(map[string]any)
+		if defined && (!combined || !ok) {
+			return fmt.Errorf("%s: %s is already defined in %s", source, section, prev)
+		}
+
+		if !combined {
+			l.root[section] = value
+			l.sources[section] = source
+			continue
+		}
+
+		if !defined {
+			existing = map[string]any{}
+			l.root[section] = existing
+			l.sources[section] = source
+		}
+
+		for _, key := range sortedKeys(entries) {
+			id := section + "." + key
+			if prev, ok := l.sources[id]; ok {
+				return fmt.Errorf("%s: %s is already defined in %s", source, id, prev)
+			}
+
+			existing[key] = entries[key]
+			l.sources[id] = source
+		}
+	}
+
+	return nil
+}
+
+// documentImports validates the imports section of a document
+func documentImports(raw any) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("imports must be a list of strings")
+	}
+
+	imports := make([]string, len(list))
+	for i, item := range list {
+		imp, ok := item.(string)
+		if !ok || imp == "" {
+			return nil, fmt.Errorf("imports must be a list of strings")
+		}
+		imports[i] = imp
+	}
+
+	return imports, nil
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadDocument", func() {
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+
+	It("Should combine imports relative to the importing document", func() {
+		fsys := fstest.MapFS{
+			"site/main.yaml": file(`
+imports:
+  - common.yaml
+  - roles/*.yaml
+hierarchy:
+  order:
+    - role:{{ role }}
+    - env:{{ env }}
+  merge: deep
+data:
+  port: 80
+`),
+			"site/common.yaml": file(`
+imports: [envs/prod.json]
+data:
+  log_level: info
+`),
+			"site/envs/prod.json": file(`{"overrides": {"env:prod": {"log_level": "warn"}}}`),
+			"site/roles/web.yaml": file(`
+imports: [../common.yaml]
+overrides:
+  role:web:
+    port: 443
+`),
+			"site/roles/db.yaml": file(`
+overrides:
+  role:db:
+    port: 5432
+`),
+		}
+
+		root, err := LoadDocument(fsys, "site/main.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root).NotTo(HaveKey("imports"))
+		Expect(root["data"]).To(Equal(map[string]any{"port": uint64(80), "log_level": "info"}))
+		Expect(root["overrides"]).To(HaveKey("env:prod"))
+		Expect(root["overrides"]).To(HaveKey("role:web"))
+		Expect(root["overrides"]).To(HaveKey("role:db"))
+
+		resolver, err := Load(fsys, "site/main.yaml", DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := resolver.Resolve(context.Background(), map[string]any{"role": "web", "env": "prod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"port": 443, "log_level": "warn"}))
+	})
+
+	It("Should load directories with one file per override", func() {
+		fsys := fstest.MapFS{
+			"hiera.yml": file(`
+hierarchy:
+  order:
+    - role/{{ role }}
+data:
+  port: 80
+`),
+			"overrides/role/web.yaml":  file("port: 443"),
+			"overrides/role/db.json":   file(`{"port": 5432}`),
+			"overrides/role/README.md": file("ignored"),
+			"overrides/.hidden.yaml":   file("ignored: true"),
+		}
+
+		root, err := LoadDocument(fsys, ".")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root["overrides"]).To(Equal(map[string]any{
+			"role/web": map[string]any{"port": uint64(443)},
+			"role/db":  map[string]any{"port": float64(5432)},
+		}))
+
+		_, err = LoadDocument(fstest.MapFS{"overrides/x.yaml": file("a: 1")}, ".")
+		Expect(err).To(MatchError(".: no hiera.yaml, hiera.yml, hiera.json found"))
+	})
+
+	It("Should detect circular imports", func() {
+		fsys := fstest.MapFS{
+			"main.yaml": file("imports: [a.yaml]"),
+			"a.yaml":    file("imports: [b/b.yaml]"),
+			"b/b.yaml":  file("imports: [../a.yaml]"),
+		}
+
+		_, err := LoadDocument(fsys, "main.yaml")
+		Expect(err).To(MatchError("circular import: a.yaml -> b/b.yaml -> a.yaml"))
+	})
+
+	It("Should reject keys defined in many documents", func() {
+		_, err := LoadDocument(fstest.MapFS{
+			"main.yaml": file("imports: [a.yaml]\noverrides: {\"role:web\": {port: 1}}"),
+			"a.yaml":    file("overrides: {\"role:web\": {port: 2}}"),
+		}, "main.yaml")
+		Expect(err).To(MatchError("a.yaml: overrides.role:web is already defined in main.yaml"))
+
+		_, err = LoadDocument(fstest.MapFS{
+			"main.yaml": file("imports: [a.yaml]\nhierarchy: {order: [a]}"),
+			"a.yaml":    file("hierarchy: {order: [b]}"),
+		}, "main.yaml")
+		Expect(err).To(MatchError("a.yaml: hierarchy is already defined in main.yaml"))
+	})
+
+	It("Should report invalid imports", func() {
+		_, err := LoadDocument(fstest.MapFS{"main.yaml": file("imports: [missing.yaml]")}, "main.yaml")
+		Expect(err).To(MatchError("main.yaml: imported document missing.yaml does not exist"))
+
+		_, err = LoadDocument(fstest.MapFS{"main.yaml": file("imports: common.yaml")}, "main.yaml")
+		Expect(err).To(MatchError("main.yaml: imports must be a list of strings"))
+
+		_, err = New(map[string]any{"imports": []any{"common.yaml"}}, DefaultOptions)
+		Expect(err).To(MatchError("imports can only be used in documents read using Load"))
+	})
+})
@@ -2,6 +2,14 @@ package internal
 
 import (
 	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/disk"
@@ -10,89 +18,391 @@ import (
 	"github.com/shirou/gopsutil/v4/net"
 )
 
-func StandardFacts(ctx context.Context) (map[string]any, error) {
-	return standardFacts(ctx)
+// FactGroups lists the groups of standard facts, each group is a top level key in the facts
+var FactGroups = []string{"memory", "cpu", "partitions", "host", "kernel", "os", "networking", "dmi", "container"}
+
+// groupGracePeriod is how long groups may take to return what they gathered once the timeout passed
+const groupGracePeriod = 50 * time.Millisecond
+
+// GroupFacts gathers the standard facts in groups concurrently, all groups are gathered when none are given. Groups
+// that are not gathered within timeout, like partitions with a hung network mount, are left out of the facts
+func GroupFacts(ctx context.Context, timeout time.Duration, groups ...string) (map[string]any, error) {
+	if len(groups) == 0 {
+		groups = FactGroups
+	}
+
+	for _, group := range groups {
+		if !slices.Contains(FactGroups, group) {
+			return nil, fmt.Errorf("unknown fact group %q", group)
+		}
+	}
+
+	return standardFacts(ctx, timeout, groups, (&gatherer{}).gatherGroup)
+}
+
+// systemInfo holds the raw system information that is translated into facts
+type systemInfo struct {
+	virtual      *mem.VirtualMemoryStat
+	swap         *mem.SwapMemoryStat
+	cpus         []cpu.InfoStat
+	logicalCPUs  int
+	physicalCPUs int
+	partitions   []disk.PartitionStat
+	usage        map[string]*disk.UsageStat
+	host         *host.InfoStat
+	interfaces   net.InterfaceStatList
+	fqdn         string
+	domain       string
+	primary      string
+	os           map[string]any
+	dmi          map[string]any
+	container    map[string]any
+}
+
+type groupFacts struct {
+	group string
+	facts any
+}
+
+// gatherer gathers groups of facts concurrently, information needed by many groups is only gathered once
+type gatherer struct {
+	hostOnce sync.Once
+	host     *host.InfoStat
+}
+
+// hostInfo gathers the host information shared by the host, kernel, os and networking groups
+func (g *gatherer) hostInfo(ctx context.Context) *host.InfoStat {
+	g.hostOnce.Do(func() {
+		g.host, _ = host.InfoWithContext(ctx)
+	})
+
+	return g.host
+}
+
+// gatherGroup gathers the facts in a single group
+func (g *gatherer) gatherGroup(ctx context.Context, group string) any {
+	return curateFacts(g.gatherInfo(ctx, []string{group}), []string{group})[group]
 }
 
-func standardFacts(ctx context.Context) (map[string]any, error) {
-	var err error
+// standardFacts gathers every group using gather in its own goroutine. Groups that finish as the timeout passes,
+// like ones that stop when their context expires, are kept when they finish within groupGracePeriod and goroutines of
+// other groups are abandoned
+func standardFacts(ctx context.Context, timeout time.Duration, groups []string, gather func(context.Context, string) any) (map[string]any, error) {
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	swapFacts := map[string]any{
-		"info":    map[string]any{},
-		"devices": map[string]any{},
+	results := make(chan groupFacts, len(groups))
+	for _, group := range groups {
+		go func() {
+			results <- groupFacts{group: group, facts: gather(tctx, group)}
+		}()
 	}
-	memoryFacts := map[string]any{
-		"swap":    swapFacts,
-		"virtual": map[string]any{},
+
+	facts := map[string]any{}
+	for range groups {
+		select {
+		case result := <-results:
+			facts[result.group] = result.facts
+		case <-tctx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			grace := time.NewTimer(groupGracePeriod)
+			defer grace.Stop()
+
+			for len(facts) < len(groups) {
+				select {
+				case result := <-results:
+					facts[result.group] = result.facts
+				case <-grace.C:
+					return facts, nil
+				}
+			}
+
+			return facts, nil
+		}
 	}
-	cpuFacts := map[string]any{
-		"info": []any{},
+
+	return facts, nil
+}
+
+// gatherInfo gathers the raw system information needed by groups, anything that fails to gather is left empty
+func (g *gatherer) gatherInfo(ctx context.Context, groups []string) *systemInfo {
+	info := &systemInfo{usage: map[string]*disk.UsageStat{}}
+	want := func(needs ...string) bool {
+		return slices.ContainsFunc(needs, func(g string) bool { return slices.Contains(groups, g) })
+	}
+	linux := runtime.GOOS == "linux"
+
+	if want("memory") {
+		info.virtual, _ = mem.VirtualMemoryWithContext(ctx)
+		info.swap, _ = mem.SwapMemoryWithContext(ctx)
 	}
-	partitionFacts := map[string]any{
-		"partitions": []any{},
-		"usage":      []any{},
+
+	if want("cpu") {
+		info.cpus, _ = cpu.InfoWithContext(ctx)
+		info.logicalCPUs, _ = cpu.CountsWithContext(ctx, true)
+		info.physicalCPUs, _ = cpu.CountsWithContext(ctx, false)
 	}
-	hostFacts := map[string]any{
-		"info": map[string]any{},
+
+	if want("partitions") {
+		info.partitions, _ = disk.PartitionsWithContext(ctx, false)
+		for _, part := range info.partitions {
+			u, err := disk.UsageWithContext(ctx, part.Mountpoint)
+			if err != nil {
+				continue
+			}
+			info.usage[part.Mountpoint] = u
+		}
 	}
-	networkFacts := map[string]any{
-		"interfaces": []any{},
+
+	if want("host", "kernel", "networking") {
+		info.host = g.hostInfo(ctx)
 	}
 
-	virtual, err := mem.VirtualMemoryWithContext(ctx)
-	if err == nil {
-		memoryFacts["virtual"] = virtual
+	if want("networking") {
+		info.interfaces, _ = net.InterfacesWithContext(ctx)
+		if info.host != nil {
+			info.fqdn, info.domain = resolveFQDN("/", info.host.Hostname)
+		}
+		info.primary = primaryInterface("/")
 	}
 
-	swap, err := mem.SwapMemoryWithContext(ctx)
-	if err == nil {
-		swapFacts["info"] = swap
+	if want("os") {
+		if linux {
+			info.os = osFacts("/")
+		}
+		// the host platform is only used when there is no os-release
+		if info.os == nil {
+			info.host = g.hostInfo(ctx)
+		}
 	}
-	swapDev, err := mem.SwapDevicesWithContext(ctx)
-	if err == nil {
-		swapFacts["devices"] = swapDev
+	if linux && want("dmi") {
+		info.dmi = dmiFacts("/")
 	}
+	if linux && want("container") {
+		info.container = containerFacts("/", os.Getenv)
+	}
+
+	return info
+}
 
-	cpuInfo, err := cpu.InfoWithContext(ctx)
-	if err == nil {
-		cpuFacts["info"] = cpuInfo
+// curateFacts translates raw system information into facts following the documented fact schema, only groups are included
+func curateFacts(info *systemInfo, groups []string) map[string]any {
+	facts := map[string]any{}
+
+	for _, group := range groups {
+		switch group {
+		case "memory":
+			facts[group] = memoryFacts(info.virtual, info.swap)
+		case "cpu":
+			facts[group] = cpuFacts(info.cpus, info.logicalCPUs, info.physicalCPUs)
+		case "partitions":
+			facts[group] = partitionFacts(info.partitions, info.usage)
+		case "host":
+			facts[group] = hostFacts(info.host)
+		case "kernel":
+			facts[group] = kernelFacts(info.host)
+		case "os":
+			facts[group] = platformFacts(info.os, info.host)
+		case "networking":
+			facts[group] = networkingFacts(info)
+		case "dmi":
+			facts[group] = emptyIfNil(info.dmi)
+		case "container":
+			facts[group] = emptyIfNil(info.container)
+		}
 	}
 
-	parts, err := disk.PartitionsWithContext(ctx, false)
-	if err == nil {
-		if len(parts) > 0 {
-			matchedParts := []disk.PartitionStat{}
-			usages := []*disk.UsageStat{}
+	return facts
+}
 
-			for _, part := range parts {
-				matchedParts = append(matchedParts, part)
-				u, err := disk.UsageWithContext(ctx, part.Mountpoint)
-				if err != nil {
-					continue
-				}
-				usages = append(usages, u)
-			}
+func memoryFacts(virtual *mem.VirtualMemoryStat, swap *mem.SwapMemoryStat) map[string]any {
+	facts := map[string]any{}
+
+	if virtual != nil {
+		facts["total_bytes"] = virtual.Total
+		facts["available_bytes"] = virtual.Available
+		facts["used_bytes"] = virtual.Used
+		facts["free_bytes"] = virtual.Free
+		facts["used_percent"] = virtual.UsedPercent
+	}
 
-			partitionFacts["partitions"] = matchedParts
-			partitionFacts["usage"] = usages
+	if swap != nil {
+		facts["swap"] = map[string]any{
+			"total_bytes":  swap.Total,
+			"used_bytes":   swap.Used,
+			"free_bytes":   swap.Free,
+			"used_percent": swap.UsedPercent,
 		}
 	}
 
-	hostInfo, err := host.InfoWithContext(ctx)
-	if err == nil {
-		hostFacts["info"] = hostInfo
+	return facts
+}
+
+func cpuFacts(cpus []cpu.InfoStat, logical int, physical int) map[string]any {
+	facts := map[string]any{
+		"count":          logical,
+		"physical_count": physical,
 	}
 
-	interfaces, err := net.InterfacesWithContext(ctx)
-	if err == nil {
-		networkFacts["interfaces"] = interfaces
+	if len(cpus) > 0 {
+		facts["model"] = cpus[0].ModelName
+		facts["vendor"] = cpus[0].VendorID
+		facts["mhz"] = cpus[0].Mhz
+	}
+
+	return facts
+}
+
+func partitionFacts(partitions []disk.PartitionStat, usage map[string]*disk.UsageStat) map[string]any {
+	facts := map[string]any{}
+
+	for _, part := range partitions {
+		options := make([]any, len(part.Opts))
+		for i, opt := range part.Opts {
+			options[i] = opt
+		}
+
+		pf := map[string]any{
+			"device":     part.Device,
+			"filesystem": part.Fstype,
+			"options":    options,
+		}
+
+		if u, ok := usage[part.Mountpoint]; ok && u != nil {
+			pf["total_bytes"] = u.Total
+			pf["used_bytes"] = u.Used
+			pf["free_bytes"] = u.Free
+			pf["used_percent"] = u.UsedPercent
+		}
+
+		facts[part.Mountpoint] = pf
+	}
+
+	return facts
+}
+
+func hostFacts(info *host.InfoStat) map[string]any {
+	if info == nil {
+		return map[string]any{}
 	}
 
 	return map[string]any{
-		"memory":    memoryFacts,
-		"cpu":       cpuFacts,
-		"partition": partitionFacts,
-		"host":      hostFacts,
-		"network":   networkFacts,
-	}, nil
+		"hostname":       info.Hostname,
+		"id":             info.HostID,
+		"uptime_seconds": info.Uptime,
+		"boot_time":      info.BootTime,
+		"processes":      info.Procs,
+		"virtualization": map[string]any{
+			"system": info.VirtualizationSystem,
+			"role":   info.VirtualizationRole,
+		},
+	}
+}
+
+func kernelFacts(info *host.InfoStat) map[string]any {
+	if info == nil {
+		return map[string]any{}
+	}
+
+	return map[string]any{
+		"name":    info.OS,
+		"version": info.KernelVersion,
+		"arch":    info.KernelArch,
+	}
+}
+
+// platformFacts uses the parsed os-release when available and the platform reported by the host otherwise
+func platformFacts(release map[string]any, info *host.InfoStat) map[string]any {
+	if release != nil {
+		return release
+	}
+
+	if info == nil {
+		return map[string]any{}
+	}
+
+	major, _, _ := strings.Cut(info.PlatformVersion, ".")
+
+	return map[string]any{
+		"id":            info.Platform,
+		"name":          info.Platform,
+		"version_id":    info.PlatformVersion,
+		"version_major": major,
+		"family":        info.PlatformFamily,
+	}
+}
+
+func networkingFacts(info *systemInfo) map[string]any {
+	facts := map[string]any{}
+
+	if info.host != nil {
+		short, _, _ := strings.Cut(info.host.Hostname, ".")
+		facts["hostname"] = short
+		facts["fqdn"] = info.fqdn
+		facts["domain"] = info.domain
+	}
+
+	ifaces := map[string]any{}
+	for _, iface := range info.interfaces {
+		ip4 := []any{}
+		ip6 := []any{}
+
+		for _, addr := range iface.Addrs {
+			prefix, err := netip.ParsePrefix(addr.Addr)
+			if err != nil {
+				continue
+			}
+
+			if prefix.Addr().Is4() {
+				ip4 = append(ip4, prefix.Addr().String())
+			} else {
+				ip6 = append(ip6, prefix.Addr().String())
+			}
+		}
+
+		flags := make([]any, len(iface.Flags))
+		for i, flag := range iface.Flags {
+			flags[i] = flag
+		}
+
+		ifaceFacts := map[string]any{
+			"index":     iface.Index,
+			"mac":       iface.HardwareAddr,
+			"mtu":       iface.MTU,
+			"flags":     flags,
+			"addresses": map[string]any{"ip4": ip4, "ip6": ip6},
+		}
+		if len(ip4) > 0 {
+			ifaceFacts["ip4"] = ip4[0]
+		}
+		if len(ip6) > 0 {
+			ifaceFacts["ip6"] = ip6[0]
+		}
+
+		ifaces[iface.Name] = ifaceFacts
+	}
+	facts["interfaces"] = ifaces
+
+	if primary, ok := ifaces[info.primary].(map[string]any); ok {
+		facts["primary"] = info.primary
+		facts["mac"] = primary["mac"]
+		for _, key := range []string{"ip4", "ip6"} {
+			if ip, ok := primary[key]; ok {
+				facts[key] = ip
+			}
+		}
+	}
+
+	return facts
+}
+
+func emptyIfNil(facts map[string]any) map[string]any {
+	if facts == nil {
+		return map[string]any{}
+	}
+
+	return facts
 }
@@ -0,0 +1,192 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/shirou/gopsutil/v4/net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// set TINYHIERA_UPDATE_GOLDEN=1 to rewrite the golden files after intentional fact changes
+func expectGolden(file string, value any) {
+	actual, err := json.MarshalIndent(value, "", "  ")
+	Expect(err).NotTo(HaveOccurred())
+
+	path := filepath.Join("testdata", file)
+	if os.Getenv("TINYHIERA_UPDATE_GOLDEN") == "1" {
+		Expect(os.WriteFile(path, append(actual, '\n'), 0644)).To(Succeed())
+	}
+
+	expected, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(actual) + "\n").To(Equal(string(expected)))
+}
+
+// factPaths lists the paths to all leaves in facts, map keys below fields documented with a * are replaced by *
+func factPaths(prefix []string, value any) []string {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return []string{strings.Join(prefix, ".")}
+	}
+
+	var paths []string
+	for key, val := range m {
+		segment := key
+		if slices.ContainsFunc(factDocs, func(d factDoc) bool { return d.path == strings.Join(append(slices.Clone(prefix), "*"), ".") }) {
+			segment = "*"
+		}
+		paths = append(paths, factPaths(append(slices.Clone(prefix), segment), val)...)
+	}
+
+	return paths
+}
+
+var _ = Describe("Standard facts", func() {
+	info := &systemInfo{
+		virtual:      &mem.VirtualMemoryStat{Total: 8000, Available: 6000, Used: 2000, Free: 5000, UsedPercent: 25},
+		swap:         &mem.SwapMemoryStat{Total: 1000, Used: 100, Free: 900, UsedPercent: 10},
+		cpus:         []cpu.InfoStat{{VendorID: "GenuineIntel", ModelName: "Intel(R) Xeon(R)", Mhz: 2400}},
+		logicalCPUs:  8,
+		physicalCPUs: 4,
+		partitions: []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4", Opts: []string{"rw", "relatime"}},
+			{Device: "tmpfs", Mountpoint: "/run", Fstype: "tmpfs", Opts: []string{"rw"}},
+		},
+		usage: map[string]*disk.UsageStat{
+			"/": {Total: 100, Used: 40, Free: 60, UsedPercent: 40},
+		},
+		host: &host.InfoStat{
+			Hostname: "web01", Uptime: 3600, BootTime: 1760000000, Procs: 120, OS: "linux", Platform: "rocky",
+			PlatformFamily: "rhel", PlatformVersion: "9.4", KernelVersion: "5.14.0", KernelArch: "x86_64",
+			VirtualizationSystem: "kvm", VirtualizationRole: "guest", HostID: "abc-123",
+		},
+		interfaces: net.InterfaceStatList{
+			{Index: 1, MTU: 65536, Name: "lo", Flags: []string{"up", "loopback"}, Addrs: net.InterfaceAddrList{{Addr: "127.0.0.1/8"}, {Addr: "::1/128"}}},
+			{Index: 2, MTU: 1500, Name: "eth0", HardwareAddr: "52:54:00:12:34:56", Flags: []string{"up", "broadcast"}, Addrs: net.InterfaceAddrList{{Addr: "192.168.1.10/24"}, {Addr: "192.168.1.11/24"}, {Addr: "fe80::1/64"}}},
+		},
+		fqdn:    "web01.example.net",
+		domain:  "example.net",
+		primary: "eth0",
+		os: map[string]any{
+			"id": "rocky", "name": "Rocky Linux", "pretty_name": "Rocky Linux 9.4", "version_id": "9.4", "version_major": "9",
+			"version_codename": "", "id_like": []string{"rhel"}, "family": "redhat", "systemd": true, "init": "systemd",
+		},
+		dmi: map[string]any{
+			"manufacturer": "QEMU", "chassis_type": "1",
+			"product": map[string]any{"name": "Standard PC", "version": "1.0", "serial": "S1", "uuid": "U1"},
+			"board":   map[string]any{"manufacturer": "QEMU", "product": "Q35", "serial": "B1"},
+			"bios":    map[string]any{"vendor": "SeaBIOS", "version": "1.16", "release_date": "04/01/2014"},
+		},
+		container: map[string]any{"in_container": false, "runtime": ""},
+	}
+
+	It("Should match the golden facts", func() {
+		expectGolden("facts.golden.json", curateFacts(info, FactGroups))
+	})
+
+	It("Should match the golden schema", func() {
+		expectGolden("schema.golden.json", FactsSchema())
+	})
+
+	It("Should document every fact", func() {
+		var documented []string
+		for _, doc := range factDocs {
+			documented = append(documented, doc.path)
+		}
+
+		for _, path := range factPaths(nil, curateFacts(info, FactGroups)) {
+			Expect(documented).To(ContainElement(path))
+		}
+	})
+
+	It("Should handle missing information", func() {
+		facts := curateFacts(&systemInfo{}, FactGroups)
+		Expect(facts["memory"]).To(Equal(map[string]any{}))
+		Expect(facts["os"]).To(Equal(map[string]any{}))
+		Expect(facts["networking"]).To(Equal(map[string]any{"interfaces": map[string]any{}}))
+	})
+
+	It("Should only include the requested groups", func() {
+		facts := curateFacts(info, []string{"kernel", "unknown", "cpu"})
+		Expect(facts).To(HaveLen(2))
+		Expect(facts).To(HaveKey("kernel"))
+		Expect(facts).To(HaveKey("cpu"))
+	})
+
+	It("Should reject unknown groups", func() {
+		_, err := GroupFacts(context.Background(), time.Second, "kernel", "network")
+		Expect(err).To(MatchError(`unknown fact group "network"`))
+	})
+
+	It("Should leave out groups that time out", func() {
+		block := make(chan struct{})
+		defer close(block)
+
+		gather := func(_ context.Context, group string) any {
+			if group == "partitions" {
+				<-block
+			}
+			return map[string]any{"group": group}
+		}
+
+		facts, err := standardFacts(context.Background(), 50*time.Millisecond, []string{"kernel", "partitions", "os"}, gather)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(map[string]any{
+			"kernel": map[string]any{"group": "kernel"},
+			"os":     map[string]any{"group": "os"},
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = standardFacts(ctx, time.Minute, []string{"partitions"}, gather)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("Should keep groups finishing at the timeout", func() {
+		block := make(chan struct{})
+		defer close(block)
+
+		gather := func(ctx context.Context, group string) any {
+			switch group {
+			case "partitions":
+				<-block
+			case "os", "networking":
+				<-ctx.Done()
+				return map[string]any{"group": group, "partial": true}
+			}
+			return map[string]any{"group": group}
+		}
+
+		start := time.Now()
+		facts, err := standardFacts(context.Background(), 50*time.Millisecond, []string{"kernel", "partitions", "os", "networking"}, gather)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 50*time.Millisecond+groupGracePeriod+50*time.Millisecond))
+		Expect(facts).To(Equal(map[string]any{
+			"kernel":     map[string]any{"group": "kernel"},
+			"os":         map[string]any{"group": "os", "partial": true},
+			"networking": map[string]any{"group": "networking", "partial": true},
+		}))
+	})
+
+	It("Should use the host platform without os-release", func() {
+		Expect(platformFacts(nil, info.host)).To(Equal(map[string]any{
+			"id": "rocky", "name": "rocky", "version_id": "9.4", "version_major": "9", "family": "rhel",
+		}))
+	})
+})
@@ -0,0 +1,131 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// resolveFQDN determines the fully qualified name of hostname using only local files, root is the file system root.
+//
+// A hostname that already holds a domain is used as is, otherwise the first name holding a domain on a line of
+// /etc/hosts that lists the hostname is used and finally the domain or first search domain in /etc/resolv.conf
+func resolveFQDN(root string, hostname string) (fqdn string, domain string) {
+	if hostname == "" {
+		return "", ""
+	}
+
+	if short, domain, ok := strings.Cut(hostname, "."); ok && short != "" {
+		return hostname, domain
+	}
+
+	hosts, _ := os.ReadFile(filepath.Join(root, "etc/hosts"))
+	scanner := bufio.NewScanner(bytes.NewReader(hosts))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		names := fields[1:]
+		found := false
+		for _, name := range names {
+			if name == hostname || strings.HasPrefix(name, hostname+".") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		for _, name := range names {
+			if strings.HasPrefix(name, hostname+".") {
+				return name, strings.TrimPrefix(name, hostname+".")
+			}
+		}
+	}
+
+	resolv, _ := os.ReadFile(filepath.Join(root, "etc/resolv.conf"))
+	scanner = bufio.NewScanner(bytes.NewReader(resolv))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		if fields[0] == "domain" || fields[0] == "search" {
+			domain := strings.TrimSuffix(fields[1], ".")
+			return hostname + "." + domain, domain
+		}
+	}
+
+	return hostname, ""
+}
+
+// primaryInterface finds the interface holding the IPv4 default route with the lowest metric using
+// /proc/net/route, the IPv6 default route is used when there is no IPv4 one. root is the file system root
+func primaryInterface(root string) string {
+	iface := ""
+	best := math.MaxInt
+
+	routes, _ := os.ReadFile(filepath.Join(root, "proc/net/route"))
+	scanner := bufio.NewScanner(bytes.NewReader(routes))
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[0] == "Iface" {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&0x1 == 0 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+
+		if metric < best {
+			iface = fields[0]
+			best = metric
+		}
+	}
+
+	if iface != "" {
+		return iface
+	}
+
+	routes, _ = os.ReadFile(filepath.Join(root, "proc/net/ipv6_route"))
+	scanner = bufio.NewScanner(bytes.NewReader(routes))
+	for scanner.Scan() {
+		// destination prefix_length source source_prefix_length next_hop metric refcnt use flags iface
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[0] != strings.Repeat("0", 32) || fields[1] != "00" || fields[9] == "lo" {
+			continue
+		}
+
+		metric, err := strconv.ParseInt(fields[5], 16, 64)
+		if err != nil {
+			continue
+		}
+
+		if int(metric) < best {
+			iface = fields[9]
+			best = int(metric)
+		}
+	}
+
+	return iface
+}
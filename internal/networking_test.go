@@ -0,0 +1,90 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Networking", func() {
+	var root string
+
+	write := func(file string, content string) {
+		path := filepath.Join(root, file)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+	})
+
+	Describe("resolveFQDN", func() {
+		It("Should use hostnames holding a domain as is", func() {
+			fqdn, domain := resolveFQDN(root, "web01.example.net")
+			Expect(fqdn).To(Equal("web01.example.net"))
+			Expect(domain).To(Equal("example.net"))
+		})
+
+		It("Should find the name in the hosts file", func() {
+			write("etc/hosts", "127.0.0.1 localhost\n# 10.0.0.1 web01.wrong.net web01\n10.0.0.1 web01 web01.example.net # comment\n")
+
+			fqdn, domain := resolveFQDN(root, "web01")
+			Expect(fqdn).To(Equal("web01.example.net"))
+			Expect(domain).To(Equal("example.net"))
+		})
+
+		It("Should use the resolv.conf domain", func() {
+			write("etc/hosts", "127.0.0.1 localhost web01\n")
+			write("etc/resolv.conf", "nameserver 10.0.0.53\nsearch example.net. other.net\n")
+
+			fqdn, domain := resolveFQDN(root, "web01")
+			Expect(fqdn).To(Equal("web01.example.net"))
+			Expect(domain).To(Equal("example.net"))
+		})
+
+		It("Should use the short name when no domain is known", func() {
+			fqdn, domain := resolveFQDN(root, "web01")
+			Expect(fqdn).To(Equal("web01"))
+			Expect(domain).To(BeEmpty())
+
+			fqdn, domain = resolveFQDN(root, "")
+			Expect(fqdn).To(BeEmpty())
+			Expect(domain).To(BeEmpty())
+		})
+	})
+
+	Describe("primaryInterface", func() {
+		It("Should find the IPv4 default route with the lowest metric", func() {
+			write("proc/net/route", `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth1	00000000	0101A8C0	0003	0	0	600	00000000	0	0	0
+eth0	00000000	0100000A	0003	0	0	100	00000000	0	0	0
+eth2	0000000A	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth3	00000000	0100000A	0002	0	0	0	00000000	0	0	0
+`)
+
+			Expect(primaryInterface(root)).To(Equal("eth0"))
+		})
+
+		It("Should fall back to the IPv6 default route", func() {
+			write("proc/net/route", "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n")
+			write("proc/net/ipv6_route", `fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth1
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000064 00000001 00000000 00000003     eth0
+`)
+
+			Expect(primaryInterface(root)).To(Equal("eth0"))
+		})
+
+		It("Should return nothing without routes", func() {
+			Expect(primaryInterface(root)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,177 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"strings"
+)
+
+// FactsSchemaVersion is the version of the standard fact schema, it is increased whenever facts are renamed or removed
+const FactsSchemaVersion = 1
+
+// factDoc documents a single standard fact, a * path segment matches any key
+type factDoc struct {
+	path        string
+	kind        string
+	description string
+}
+
+var factDocs = []factDoc{
+	{"memory", "object", "System memory"},
+	{"memory.total_bytes", "integer", "Total physical memory"},
+	{"memory.available_bytes", "integer", "Memory available to programs without swapping"},
+	{"memory.used_bytes", "integer", "Memory used by programs"},
+	{"memory.free_bytes", "integer", "Memory that is not used at all"},
+	{"memory.used_percent", "number", "Percentage of total memory that is used"},
+	{"memory.swap", "object", "Swap space"},
+	{"memory.swap.total_bytes", "integer", "Total swap space"},
+	{"memory.swap.used_bytes", "integer", "Swap space in use"},
+	{"memory.swap.free_bytes", "integer", "Swap space that is not in use"},
+	{"memory.swap.used_percent", "number", "Percentage of swap space in use"},
+
+	{"cpu", "object", "Processors"},
+	{"cpu.count", "integer", "Number of logical processors"},
+	{"cpu.physical_count", "integer", "Number of physical cores"},
+	{"cpu.model", "string", "Processor model name"},
+	{"cpu.vendor", "string", "Processor vendor"},
+	{"cpu.mhz", "number", "Processor speed"},
+
+	{"partitions", "object", "Mounted file systems keyed by mount point"},
+	{"partitions.*", "object", "A mounted file system"},
+	{"partitions.*.device", "string", "The device holding the file system"},
+	{"partitions.*.filesystem", "string", "File system type"},
+	{"partitions.*.options", "[]string", "Mount options"},
+	{"partitions.*.total_bytes", "integer", "Size of the file system"},
+	{"partitions.*.used_bytes", "integer", "Space in use"},
+	{"partitions.*.free_bytes", "integer", "Space available"},
+	{"partitions.*.used_percent", "number", "Percentage of space in use"},
+
+	{"host", "object", "The host"},
+	{"host.hostname", "string", "Host name"},
+	{"host.id", "string", "Unique host identifier"},
+	{"host.uptime_seconds", "integer", "Seconds since the host booted"},
+	{"host.boot_time", "integer", "Unix time the host booted"},
+	{"host.processes", "integer", "Number of running processes"},
+	{"host.virtualization", "object", "Virtualization"},
+	{"host.virtualization.system", "string", "Virtualization system like kvm or xen, empty when not known"},
+	{"host.virtualization.role", "string", "Virtualization role, guest or host"},
+
+	{"kernel", "object", "The operating system kernel"},
+	{"kernel.name", "string", "Kernel name like linux or darwin"},
+	{"kernel.version", "string", "Kernel version"},
+	{"kernel.arch", "string", "Machine architecture like x86_64 or arm64"},
+
+	{"os", "object", "The operating system, from os-release on Linux"},
+	{"os.id", "string", "Operating system identifier like debian or rocky"},
+	{"os.name", "string", "Operating system name"},
+	{"os.pretty_name", "string", "Operating system name including the version"},
+	{"os.version_id", "string", "Operating system version"},
+	{"os.version_major", "string", "Major operating system version"},
+	{"os.version_codename", "string", "Release code name"},
+	{"os.id_like", "[]string", "Identifiers of related operating systems"},
+	{"os.family", "string", "Operating system family like debian, redhat or suse"},
+	{"os.systemd", "boolean", "Indicates if systemd is running"},
+	{"os.init", "string", "Name of the init process"},
+
+	{"networking", "object", "Networking"},
+	{"networking.hostname", "string", "Host name without the domain"},
+	{"networking.domain", "string", "Domain name, empty when not known"},
+	{"networking.fqdn", "string", "Fully qualified host name determined from /etc/hosts and /etc/resolv.conf without network lookups"},
+	{"networking.primary", "string", "Interface holding the default route"},
+	{"networking.ip4", "string", "First IPv4 address of the primary interface"},
+	{"networking.ip6", "string", "First IPv6 address of the primary interface"},
+	{"networking.mac", "string", "Hardware address of the primary interface"},
+	{"networking.interfaces", "object", "Network interfaces keyed by name"},
+	{"networking.interfaces.*", "object", "A network interface"},
+	{"networking.interfaces.*.index", "integer", "Interface index"},
+	{"networking.interfaces.*.mac", "string", "Hardware address"},
+	{"networking.interfaces.*.mtu", "integer", "Maximum transmission unit"},
+	{"networking.interfaces.*.flags", "[]string", "Interface flags like up and loopback"},
+	{"networking.interfaces.*.ip4", "string", "First IPv4 address"},
+	{"networking.interfaces.*.ip6", "string", "First IPv6 address"},
+	{"networking.interfaces.*.addresses", "object", "All addresses on the interface"},
+	{"networking.interfaces.*.addresses.ip4", "[]string", "IPv4 addresses"},
+	{"networking.interfaces.*.addresses.ip6", "[]string", "IPv6 addresses"},
+
+	{"dmi", "object", "Hardware identification on Linux, values that can not be read are omitted"},
+	{"dmi.manufacturer", "string", "System manufacturer"},
+	{"dmi.chassis_type", "string", "Chassis type number"},
+	{"dmi.product", "object", "The product"},
+	{"dmi.product.name", "string", "Product name"},
+	{"dmi.product.version", "string", "Product version"},
+	{"dmi.product.serial", "string", "Product serial number"},
+	{"dmi.product.uuid", "string", "Product UUID"},
+	{"dmi.board", "object", "The main board"},
+	{"dmi.board.manufacturer", "string", "Board manufacturer"},
+	{"dmi.board.product", "string", "Board product name"},
+	{"dmi.board.serial", "string", "Board serial number"},
+	{"dmi.bios", "object", "The BIOS"},
+	{"dmi.bios.vendor", "string", "BIOS vendor"},
+	{"dmi.bios.version", "string", "BIOS version"},
+	{"dmi.bios.release_date", "string", "BIOS release date"},
+
+	{"container", "object", "Container detection on Linux"},
+	{"container.in_container", "boolean", "Indicates if the process runs in a container"},
+	{"container.runtime", "string", "Container runtime like docker, podman, lxc or kubernetes, empty when not in a container"},
+}
+
+// FactsSchema describes the standard facts as a JSON Schema
+func FactsSchema() map[string]any {
+	root := map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "tinyhiera standard facts",
+		"version":     FactsSchemaVersion,
+		"type":        "object",
+		"properties":  map[string]any{},
+		"description": "Facts gathered by the internal fact provider",
+	}
+
+	for _, doc := range factDocs {
+		node := root
+		segments := strings.Split(doc.path, ".")
+
+		for _, segment := range segments[:len(segments)-1] {
+			node = childSchema(node, segment)
+		}
+
+		leaf := childSchema(node, segments[len(segments)-1])
+		leaf["description"] = doc.description
+
+		if item, ok := strings.CutPrefix(doc.kind, "[]"); ok {
+			leaf["type"] = "array"
+			leaf["items"] = map[string]any{"type": item}
+		} else {
+			leaf["type"] = doc.kind
+		}
+	}
+
+	return root
+}
+
+// childSchema finds or creates the schema for key in the object schema node, * creates additionalProperties
+func childSchema(node map[string]any, key string) map[string]any {
+	if key == "*" {
+		child, ok := node["additionalProperties"].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			node["additionalProperties"] = child
+		}
+		return child
+	}
+
+	props, ok := node["properties"].(map[string]any)
+	if !ok {
+		props = map[string]any{}
+		node["properties"] = props
+	}
+
+	child, ok := props[key].(map[string]any)
+	if !ok {
+		child = map[string]any{}
+		props[key] = child
+	}
+
+	return child
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// osFamilies maps os-release ids to the family they belong to, ID_LIKE is consulted when ID is not known
+var osFamilies = map[string]string{
+	"debian":    "debian",
+	"ubuntu":    "debian",
+	"raspbian":  "debian",
+	"rhel":      "redhat",
+	"centos":    "redhat",
+	"fedora":    "redhat",
+	"rocky":     "redhat",
+	"almalinux": "redhat",
+	"ol":        "redhat",
+	"amzn":      "redhat",
+	"suse":      "suse",
+	"sles":      "suse",
+	"opensuse":  "suse",
+	"arch":      "arch",
+	"alpine":    "alpine",
+	"gentoo":    "gentoo",
+}
+
+// osFacts parses os-release and detects the init system, root is the file system root
+func osFacts(root string) map[string]any {
+	facts := map[string]any{}
+
+	release := map[string]string{}
+	for _, file := range []string{"etc/os-release", "usr/lib/os-release"} {
+		data, err := os.ReadFile(filepath.Join(root, file))
+		if err == nil {
+			release = parseOSRelease(data)
+			break
+		}
+	}
+
+	if len(release) > 0 {
+		id := release["ID"]
+		facts["id"] = id
+		facts["name"] = release["NAME"]
+		facts["pretty_name"] = release["PRETTY_NAME"]
+		facts["version_id"] = release["VERSION_ID"]
+		facts["version_codename"] = release["VERSION_CODENAME"]
+
+		major, _, _ := strings.Cut(release["VERSION_ID"], ".")
+		facts["version_major"] = major
+
+		like := strings.Fields(release["ID_LIKE"])
+		facts["id_like"] = like
+
+		family, ok := osFamilies[id]
+		if !ok {
+			family = id
+			for _, l := range like {
+				if f, ok := osFamilies[l]; ok {
+					family = f
+					break
+				}
+			}
+		}
+		facts["family"] = family
+	}
+
+	_, err := os.Stat(filepath.Join(root, "run/systemd/system"))
+	facts["systemd"] = err == nil
+
+	comm, err := os.ReadFile(filepath.Join(root, "proc/1/comm"))
+	if err == nil {
+		facts["init"] = strings.TrimSpace(string(comm))
+	} else if facts["systemd"] == true {
+		facts["init"] = "systemd"
+	}
+
+	return facts
+}
+
+// parseOSRelease parses the shell style variable assignments in os-release files
+func parseOSRelease(data []byte) map[string]string {
+	result := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"'`)
+		}
+
+		result[key] = value
+	}
+
+	return result
+}
+
+// dmiFacts reads hardware identification from sysfs, root is the file system root. Files that can not be read,
+// serials are often only readable by root, are omitted
+func dmiFacts(root string) map[string]any {
+	dir := filepath.Join(root, "sys/class/dmi/id")
+
+	read := func(target map[string]any, key string, file string) {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return
+		}
+
+		value := strings.TrimSpace(string(data))
+		if value != "" {
+			target[key] = value
+		}
+	}
+
+	product := map[string]any{}
+	read(product, "name", "product_name")
+	read(product, "version", "product_version")
+	read(product, "serial", "product_serial")
+	read(product, "uuid", "product_uuid")
+
+	board := map[string]any{}
+	read(board, "manufacturer", "board_vendor")
+	read(board, "product", "board_name")
+	read(board, "serial", "board_serial")
+
+	bios := map[string]any{}
+	read(bios, "vendor", "bios_vendor")
+	read(bios, "version", "bios_version")
+	read(bios, "release_date", "bios_date")
+
+	facts := map[string]any{
+		"product": product,
+		"board":   board,
+		"bios":    bios,
+	}
+	read(facts, "manufacturer", "sys_vendor")
+	read(facts, "chassis_type", "chassis_type")
+
+	return facts
+}
+
+// containerFacts detects if the process runs in a container and which runtime manages it, root is the file system
+// root and getenv looks up environment variables of the process
+func containerFacts(root string, getenv func(string) string) map[string]any {
+	runtime := detectContainerRuntime(root, getenv)
+
+	return map[string]any{
+		"in_container": runtime != "",
+		"runtime":      runtime,
+	}
+}
+
+func detectContainerRuntime(root string, getenv func(string) string) string {
+	if getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+
+	cgroup, _ := os.ReadFile(filepath.Join(root, "proc/1/cgroup"))
+	switch {
+	case bytes.Contains(cgroup, []byte("kubepods")):
+		return "kubernetes"
+	case bytes.Contains(cgroup, []byte("libpod")):
+		return "podman"
+	case bytes.Contains(cgroup, []byte("docker")):
+		return "docker"
+	case bytes.Contains(cgroup, []byte("/lxc")):
+		return "lxc"
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "run/.containerenv")); err == nil {
+		return "podman"
+	}
+	if _, err := os.Stat(filepath.Join(root, ".dockerenv")); err == nil {
+		return "docker"
+	}
+
+	// set by systemd-nspawn, podman, lxc and others following the systemd container interface
+	if env := getenv("container"); env != "" {
+		return env
+	}
+
+	return ""
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("System facts", func() {
+	var root string
+
+	write := func(file string, content string) {
+		path := filepath.Join(root, file)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+	})
+
+	Describe("osFacts", func() {
+		It("Should parse os-release and detect systemd", func() {
+			write("etc/os-release", `# comment
+NAME="Rocky Linux"
+VERSION="9.4 (Blue Onyx)"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.4"
+PRETTY_NAME="Rocky Linux 9.4 (Blue Onyx)"
+`)
+			write("proc/1/comm", "systemd\n")
+			Expect(os.MkdirAll(filepath.Join(root, "run/systemd/system"), 0755)).To(Succeed())
+
+			Expect(osFacts(root)).To(Equal(map[string]any{
+				"id":               "rocky",
+				"name":             "Rocky Linux",
+				"pretty_name":      "Rocky Linux 9.4 (Blue Onyx)",
+				"version_id":       "9.4",
+				"version_major":    "9",
+				"version_codename": "",
+				"id_like":          []string{"rhel", "centos", "fedora"},
+				"family":           "redhat",
+				"systemd":          true,
+				"init":             "systemd",
+			}))
+		})
+
+		It("Should use ID_LIKE for unknown distributions", func() {
+			write("usr/lib/os-release", "ID=pop\nID_LIKE='ubuntu debian'\nVERSION_ID=22.04\nVERSION_CODENAME=jammy\n")
+
+			facts := osFacts(root)
+			Expect(facts["family"]).To(Equal("debian"))
+			Expect(facts["version_codename"]).To(Equal("jammy"))
+			Expect(facts["systemd"]).To(BeFalse())
+			Expect(facts).NotTo(HaveKey("init"))
+		})
+
+		It("Should handle missing os-release", func() {
+			Expect(osFacts(root)).To(Equal(map[string]any{"systemd": false}))
+		})
+	})
+
+	Describe("dmiFacts", func() {
+		It("Should read sysfs", func() {
+			write("sys/class/dmi/id/sys_vendor", "Dell Inc.\n")
+			write("sys/class/dmi/id/product_name", "PowerEdge R640\n")
+			write("sys/class/dmi/id/product_serial", "ABC123\n")
+			write("sys/class/dmi/id/bios_vendor", "Dell Inc.\n")
+			write("sys/class/dmi/id/bios_version", "2.1.8\n")
+			write("sys/class/dmi/id/board_name", "\n")
+
+			Expect(dmiFacts(root)).To(Equal(map[string]any{
+				"manufacturer": "Dell Inc.",
+				"product":      map[string]any{"name": "PowerEdge R640", "serial": "ABC123"},
+				"board":        map[string]any{},
+				"bios":         map[string]any{"vendor": "Dell Inc.", "version": "2.1.8"},
+			}))
+		})
+	})
+
+	Describe("containerFacts", func() {
+		It("Should detect hosts", func() {
+			write("proc/1/cgroup", "0::/init.scope\n")
+			Expect(containerFacts(root, env(nil))).To(Equal(map[string]any{"in_container": false, "runtime": ""}))
+		})
+
+		It("Should detect kubernetes", func() {
+			Expect(containerFacts(root, env(map[string]string{"KUBERNETES_SERVICE_HOST": "10.0.0.1"}))["runtime"]).To(Equal("kubernetes"))
+
+			write("proc/1/cgroup", "0::/kubepods/besteffort/pod1234/abc\n")
+			Expect(containerFacts(root, env(nil))).To(Equal(map[string]any{"in_container": true, "runtime": "kubernetes"}))
+		})
+
+		It("Should detect docker and podman", func() {
+			write("proc/1/cgroup", "0::/system.slice/docker-1234.scope\n")
+			Expect(containerFacts(root, env(nil))["runtime"]).To(Equal("docker"))
+
+			write("proc/1/cgroup", "0::/\n")
+			write(".dockerenv", "")
+			Expect(containerFacts(root, env(nil))["runtime"]).To(Equal("docker"))
+
+			write("run/.containerenv", "")
+			Expect(containerFacts(root, env(nil))["runtime"]).To(Equal("podman"))
+		})
+
+		It("Should use the container environment variable", func() {
+			Expect(containerFacts(root, env(map[string]string{"container": "systemd-nspawn"}))["runtime"]).To(Equal("systemd-nspawn"))
+		})
+	})
+})
@@ -0,0 +1,215 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// LintError is the severity of issues that would prevent the document from resolving
+	LintError = "error"
+	// LintWarning is the severity of issues that are likely mistakes but do not prevent the document from resolving
+	LintWarning = "warning"
+)
+
+// LintIssue is a problem found in a data document by Lint
+type LintIssue struct {
+	// Severity is either LintError or LintWarning
+	Severity string `json:"severity"`
+	// Path is the gjson path to the offending item in the document
+	Path string `json:"path"`
+	// Message describes the problem
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Path, i.Message)
+}
+
+// Lint statically checks a data document without needing any facts.
+//
+// Every hierarchy order entry and every expression in the data and overrides are compiled, the merge settings and
+// lookup options are checked and every override is checked to be a map that can be selected by some order entry.
+// All problems are reported rather than just the first.
+func Lint(root map[string]any, opts Options) []LintIssue {
+	if opts.DataKey == "" {
+		opts.DataKey = "data"
+	}
+
+	l := &linter{}
+
+	normalizedRoot, ok := normalizeNumericValues(root).(map[string]any)
+	if !ok {
+		l.error("", "root document must be a map")
+		return l.issues
+	}
+	root = normalizedRoot
+
+	if _, ok := root["hierarchy"]; !ok {
+		root["hierarchy"] = DefaultHierarchy
+	}
+
+	if _, ok := root["imports"]; ok {
+		l.error("imports", "imports can only be used in documents read using Load")
+	}
+
+	patterns := l.lintHierarchy(root)
+
+	_, err := parseLookupOptions(root["lookup_options"])
+	if err != nil {
+		l.error("lookup_options", "%v", err)
+	}
+
+	if raw, ok := root["schema"]; ok {
+		_, err = compileSchema(raw)
+		if err != nil {
+			l.error("schema", "%v", err)
+		}
+	}
+
+	_, err = compileDerivedFacts(root["facts"])
+	if err != nil {
+		l.error("facts", "%v", err)
+	}
+
+	if data, ok := root[opts.DataKey]; ok {
+		if _, ok := data.(map[string]any); !ok {
+			l.warning(opts.DataKey, "%s must be a map to be used as data", opts.DataKey)
+		}
+		l.lintValue([]string{opts.DataKey}, data)
+	}
+
+	l.lintOverrides(root["overrides"], patterns)
+
+	return l.issues
+}
+
+type linter struct {
+	issues []LintIssue
+}
+
+func (l *linter) error(path string, format string, a ...any) {
+	l.issues = append(l.issues, LintIssue{Severity: LintError, Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+func (l *linter) warning(path string, format string, a ...any) {
+	l.issues = append(l.issues, LintIssue{Severity: LintWarning, Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// lintHierarchy checks the hierarchy section and returns patterns matching the keys each order entry can produce
+func (l *linter) lintHierarchy(root map[string]any) []*regexp.Regexp {
+	hierarchy, err := parseHierarchy(root)
+	if err != nil {
+		l.error("hierarchy", "%v", err)
+		return nil
+	}
+
+	switch strings.ToLower(hierarchy.Merge) {
+	case "", "first", "deep":
+	default:
+		l.error("hierarchy.merge", "unsupported merge mode: %s", hierarchy.Merge)
+	}
+
+	if hierarchy.ArrayMerge != "" {
+		strategy, err := parseArrayStrategy(hierarchy.ArrayMerge)
+		switch {
+		case err != nil:
+			l.error("hierarchy.array_merge", "%v", err)
+		case strategy == ArrayByKey:
+			l.error("hierarchy.array_merge", "the %s array strategy can only be set in lookup_options", ArrayByKey)
+		}
+	}
+
+	var patterns []*regexp.Regexp
+	for i, entry := range hierarchy.Order {
+		_, err := compileOrderEntry(entry)
+		if err != nil {
+			l.error(fmt.Sprintf("hierarchy.order.%d", i), "%v", err)
+		}
+
+		patterns = append(patterns, orderPattern(entry.Name))
+	}
+
+	return patterns
+}
+
+// lintOverrides checks every override compiles and can be selected by one of the order patterns
+func (l *linter) lintOverrides(raw any, patterns []*regexp.Regexp) {
+	if raw == nil {
+		return
+	}
+
+	overrides, ok := raw.(map[string]any)
+	if !ok {
+		l.error("overrides", "overrides must be a map")
+		return
+	}
+
+	for _, key := range sortedKeys(overrides) {
+		path := []string{"overrides", key}
+
+		if _, ok := overrides[key].(map[string]any); !ok {
+			l.warning(tracePath(path), "override must be a map to be used but got %s", describeValue(overrides[key]))
+		} else {
+			l.lintValue(path, overrides[key])
+		}
+
+		if isOverridePattern(key) {
+			_, err := compileOverridePattern(key, nil)
+			if err != nil {
+				l.error(tracePath(path), "%v", err)
+			}
+			continue
+		}
+
+		if patterns != nil && !slices.ContainsFunc(patterns, func(p *regexp.Regexp) bool { return p.MatchString(key) }) {
+			l.warning(tracePath(path), "override can not be selected by any hierarchy order entry")
+		}
+	}
+}
+
+// lintValue compiles every string in value and reports those with invalid expressions
+func (l *linter) lintValue(path []string, value any) {
+	switch typed := value.(type) {
+	case string:
+		_, err := compileTemplate(typed)
+		if err != nil {
+			l.error(tracePath(path), "%v", err)
+		}
+	case map[string]any:
+		for _, key := range sortedKeys(typed) {
+			l.lintValue(append(slices.Clone(path), key), typed[key])
+		}
+	case []any:
+		for i, val := range typed {
+			l.lintValue(append(slices.Clone(path), strconv.Itoa(i)), val)
+		}
+	}
+}
+
+// orderPattern creates a regular expression matching every key an order entry could produce, placeholders match anything
+func orderPattern(entry string) *regexp.Regexp {
+	parts := placeholderRe.Split(entry, -1)
+	for i, literal := range parts {
+		parts[i] = regexp.QuoteMeta(literal)
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
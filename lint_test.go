@@ -0,0 +1,130 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"github.com/goccy/go-yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lint", func() {
+	lint := func(doc string) []LintIssue {
+		root := map[string]any{}
+		Expect(yaml.Unmarshal([]byte(doc), &root)).To(Succeed())
+		return Lint(root, DefaultOptions)
+	}
+
+	It("Should accept valid documents", func() {
+		Expect(lint(`
+hierarchy:
+  order:
+    - env:{{ lookup('env') }}
+    - role:{{ lookup('role') }}-{{ lookup('zone') }}
+    - name: global
+      when: lookup('env') != 'dev'
+  merge: deep
+
+data:
+  port: "{{ lookup('port', 80) }}"
+
+overrides:
+  env:prod: {}
+  role:web-eu: {}
+  global: {}
+`)).To(BeEmpty())
+	})
+
+	It("Should report all problems", func() {
+		issues := lint(`
+hierarchy:
+  order:
+    - env:{{ lookup('env' }}
+    - role:{{ lookup('role') }}
+    - name: "db"
+      when: "1 +"
+  merge: shallow
+  array_merge: sideways
+
+data:
+  packages:
+    - "{{ 1 + }}"
+
+overrides:
+  env:prod:
+    x: 1
+  role:web: web
+  rol:db:
+    port: "{{ lookup('port') ) }}"
+  /role:(web/: {}
+  host:*: {}
+`)
+
+		expected := []LintIssue{
+			{Severity: LintError, Path: "hierarchy.merge", Message: "unsupported merge mode: shallow"},
+			{Severity: LintError, Path: "hierarchy.array_merge", Message: "unknown array merge strategy"},
+			{Severity: LintError, Path: "hierarchy.order.0", Message: "expr compile error for 'lookup('env''"},
+			{Severity: LintError, Path: "hierarchy.order.2", Message: `hierarchy order entry "db" when: expr compile error for '1 +'`},
+			{Severity: LintError, Path: "data.packages.0", Message: "expr compile error for '1 +'"},
+			{Severity: LintError, Path: `overrides.\/role:\(web\/`, Message: "override /role:(web/: error parsing regexp: missing closing )"},
+			{Severity: LintError, Path: "overrides.rol:db.port", Message: "expr compile error for 'lookup('port') )'"},
+			{Severity: LintWarning, Path: "overrides.rol:db", Message: "override can not be selected by any hierarchy order entry"},
+			{Severity: LintWarning, Path: "overrides.role:web", Message: `override must be a map to be used but got string "web"`},
+		}
+
+		Expect(issues).To(HaveLen(len(expected)))
+		for i, issue := range issues {
+			Expect(issue.Severity).To(Equal(expected[i].Severity))
+			Expect(issue.Path).To(Equal(expected[i].Path))
+			Expect(issue.Message).To(HavePrefix(expected[i].Message))
+		}
+	})
+
+	It("Should use the default hierarchy", func() {
+		Expect(lint(`
+overrides:
+  default: {}
+  other: {}
+`)).To(Equal([]LintIssue{
+			{Severity: LintWarning, Path: "overrides.other", Message: "override can not be selected by any hierarchy order entry"},
+		}))
+	})
+
+	It("Should only warn about overrides the resolver skips", func() {
+		doc := `
+data:
+  port: 80
+overrides:
+  default: 443
+`
+		Expect(lint(doc)).To(Equal([]LintIssue{
+			{Severity: LintWarning, Path: "overrides.default", Message: "override must be a map to be used but got int 443"},
+		}))
+
+		res, err := ResolveYaml([]byte(doc), map[string]any{}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"port": 80}))
+	})
+
+	It("Should report invalid sections", func() {
+		Expect(lint(`
+hierarchy: []
+lookup_options:
+  x: wrong
+schema:
+  type: thing
+facts:
+  a: "{{ b }}"
+  b: "{{ a }}"
+overrides: []
+`)).To(Equal([]LintIssue{
+			{Severity: LintError, Path: "hierarchy", Message: "hierarchy section is required"},
+			{Severity: LintError, Path: "lookup_options", Message: `lookup_options x: unknown merge strategy "wrong"`},
+			{Severity: LintError, Path: "schema", Message: `schema.type: unknown type "thing"`},
+			{Severity: LintError, Path: "facts", Message: "circular fact reference: a -> b -> a"},
+			{Severity: LintError, Path: "overrides", Message: "overrides must be a map"},
+		}))
+	})
+})
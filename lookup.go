@@ -0,0 +1,142 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrKeyNotFound is returned by Lookup when the resolved data does not hold the requested key
+var ErrKeyNotFound = errors.New("key not found")
+
+// Lookup resolves a single key from the document, see Resolver.Lookup for details
+func Lookup(root map[string]any, facts map[string]any, key string, opts Options) (any, error) {
+	resolver, err := New(root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolver.Lookup(context.Background(), facts, key, "")
+}
+
+// Lookup resolves a single key, a gjson style path like web.listen_port, from the compiled document.
+//
+// Only the branches of the data and overrides that lead to key are evaluated and merged, expressions elsewhere in the
+// document are not evaluated and the schema is not validated. The result is the same as the value at key in the fully
+// resolved data. When strategy is not empty it is used as the merge strategy for key as if it was set in lookup_options.
+func (r *Resolver) Lookup(ctx context.Context, facts map[string]any, key string, strategy string) (any, error) {
+	lk := &lookupKey{segments: splitPath(key)}
+	if slices.Contains(lk.segments, "") {
+		return nil, fmt.Errorf("invalid key %q", key)
+	}
+
+	if strategy != "" {
+		lk.strategy = strings.ToLower(strategy)
+		if !slices.Contains(mergeStrategies, lk.strategy) {
+			return nil, fmt.Errorf("unknown merge strategy %q", strategy)
+		}
+	}
+
+	res, err := r.merge(ctx, facts, nil, lk)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := valueAt(res, lk.segments)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	return value, nil
+}
+
+// lookupKey restricts merging to the branch of the data leading to a single key
+type lookupKey struct {
+	segments []string
+	// strategy is a merge strategy for the key that takes precedence over lookup options
+	strategy string
+	// active is the stack of data() references being evaluated when this key is resolved for another reference
+	active *[]string
+}
+
+// activeRefs returns the data() references being evaluated, nil when not resolving a reference
+func (k *lookupKey) activeRefs() *[]string {
+	if k == nil {
+		return nil
+	}
+
+	return k.active
+}
+
+// options prepends the lookup strategy, if any, to the document lookup options
+func (k *lookupKey) options(options []lookupOption) []lookupOption {
+	if k == nil || k.strategy == "" {
+		return options
+	}
+
+	return append([]lookupOption{{segments: k.segments, strategy: k.strategy}}, options...)
+}
+
+// prune returns a copy of data holding only the branch leading to the key, data is returned unchanged for a nil key.
+// Slices are kept whole as their entries can only be merged correctly as a whole, knockout keys along the branch are kept.
+func (k *lookupKey) prune(data map[string]any, knockout string) map[string]any {
+	if k == nil {
+		return data
+	}
+
+	return pruneBranch(data, k.segments, knockout)
+}
+
+func pruneBranch(data map[string]any, segments []string, knockout string) map[string]any {
+	result := map[string]any{}
+
+	if knockout != "" {
+		if value, ok := data[knockout+segments[0]]; ok {
+			result[knockout+segments[0]] = value
+		}
+	}
+
+	value, ok := data[segments[0]]
+	if !ok {
+		return result
+	}
+
+	if child, ok := value.(map[string]any); ok && len(segments) > 1 {
+		result[segments[0]] = pruneBranch(child, segments[1:], knockout)
+	} else {
+		result[segments[0]] = value
+	}
+
+	return result
+}
+
+// valueAt finds the value at path in data, numeric segments index slices
+func valueAt(data any, path []string) (any, bool) {
+	for _, segment := range path {
+		switch typed := data.(type) {
+		case map[string]any:
+			value, ok := typed[segment]
+			if !ok {
+				return nil, false
+			}
+			data = value
+		case []any:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(typed) {
+				return nil, false
+			}
+			data = typed[idx]
+		default:
+			return nil, false
+		}
+	}
+
+	return data, true
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"errors"
+
+	"github.com/goccy/go-yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lookup", func() {
+	var root map[string]any
+
+	BeforeEach(func() {
+		root = map[string]any{}
+		Expect(yaml.Unmarshal([]byte(`
+hierarchy:
+  order:
+    - env:{{ lookup('env') }}
+    - role:{{ lookup('role') }}
+  merge: deep
+  knockout_prefix: "--"
+
+data:
+  log_level: INFO
+  packages:
+    - ca-certificates
+  broken: "{{ lookup('missing').value }}"
+  web:
+    listen_port: "{{ lookup('port', 80) }}"
+    tls: false
+    server_name: example.net
+
+overrides:
+  env:prod:
+    web:
+      listen_port: 443
+      tls: true
+    --log_level: ~
+
+  role:web:
+    packages:
+      - nginx
+`), &root)).To(Succeed())
+	})
+
+	facts := map[string]any{"env": "prod", "role": "web"}
+
+	It("Should fail a full resolve due to the broken expression", func() {
+		_, err := Resolve(root, facts, DefaultOptions, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should look up values without evaluating unrelated branches", func() {
+		res, err := Lookup(root, facts, "web.listen_port", DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(443))
+
+		res, err = Lookup(root, map[string]any{"port": 8080}, "web.listen_port", DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(int64(8080)))
+
+		res, err = Lookup(root, facts, "web", DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"listen_port": 443, "tls": true, "server_name": "example.net"}))
+
+		res, err = Lookup(root, facts, "packages", DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal([]any{"ca-certificates", "nginx"}))
+
+		res, err = Lookup(root, facts, "packages.1", DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal("nginx"))
+	})
+
+	It("Should honor knockouts", func() {
+		_, err := Lookup(root, facts, "log_level", DefaultOptions)
+		Expect(errors.Is(err, ErrKeyNotFound)).To(BeTrue())
+		Expect(err).To(MatchError("key not found: log_level"))
+
+		res, err := Lookup(root, map[string]any{}, "log_level", DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal("INFO"))
+	})
+
+	It("Should support a per call merge strategy", func() {
+		resolver, err := New(root, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := resolver.Lookup(context.Background(), facts, "packages", MergeReplace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal([]any{"nginx"}))
+
+		res, err = resolver.Lookup(context.Background(), facts, "web", MergeReplace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"listen_port": 443, "tls": true}))
+
+		_, err = resolver.Lookup(context.Background(), facts, "web", "sideways")
+		Expect(err).To(MatchError(`unknown merge strategy "sideways"`))
+	})
+
+	It("Should reject invalid keys", func() {
+		_, err := Lookup(root, facts, "web..port", DefaultOptions)
+		Expect(err).To(MatchError(`invalid key "web..port"`))
+	})
+})
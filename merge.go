@@ -0,0 +1,584 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Merge strategies that can be set per key using lookup_options
+const (
+	// MergeFirst takes the value from the first override that sets it, later overrides are ignored
+	MergeFirst = "first"
+	// MergeHash merges maps one level deep, nested values are replaced
+	MergeHash = "hash"
+	// MergeDeep merges maps recursively and concatenates slices
+	MergeDeep = "deep"
+	// MergeUnique combines slices without duplicates
+	MergeUnique = "unique"
+	// MergeReplace replaces the value entirely without merging
+	MergeReplace = "replace"
+)
+
+var mergeStrategies = []string{MergeFirst, MergeHash, MergeDeep, MergeUnique, MergeReplace}
+
+// Array merge strategies used when slices are merged using the deep strategy
+const (
+	// ArrayConcat appends later slices to earlier ones
+	ArrayConcat = "concat"
+	// ArrayUnique appends later slices to earlier ones preserving order and dropping duplicates
+	ArrayUnique = "unique"
+	// ArrayReplace replaces earlier slices with later ones
+	ArrayReplace = "replace"
+	// ArrayPrepend places later slices before earlier ones
+	ArrayPrepend = "prepend"
+	// ArrayByKey deep merges maps in slices that have the same value for the merge key, others are appended
+	ArrayByKey = "by_key"
+)
+
+var arrayStrategies = []string{ArrayConcat, ArrayUnique, ArrayReplace, ArrayPrepend, ArrayByKey}
+
+// lookupOption sets the merge strategy for values matching a path
+type lookupOption struct {
+	// segments is the parsed path, a * segment matches any key and a # segment matches slice entries
+	segments []string
+	// strategy is the merge strategy to apply, empty when only the array strategy is set
+	strategy string
+	// arrayMerge is the array merge strategy to apply, empty to use the default
+	arrayMerge string
+	// mergeKey is the key used to match maps in slices for the by_key array strategy
+	mergeKey string
+}
+
+// matches determines if the option applies to path
+func (o lookupOption) matches(path []string) bool {
+	if len(path) != len(o.segments) {
+		return false
+	}
+
+	for i, segment := range o.segments {
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseLookupOptions parses the lookup_options section of a document, it maps paths to either a merge strategy or
+// a map holding a merge key, the merge key can be a strategy or a map with a strategy key like in Hiera
+func parseLookupOptions(raw any) ([]lookupOption, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	section, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("lookup_options must be a map")
+	}
+
+	keys := make([]string, 0, len(section))
+	for key := range section {
+		keys = append(keys, key)
+	}
+	// exact paths are consulted before wildcards so the most specific option wins
+	slices.SortFunc(keys, func(a, b string) int {
+		aw, bw := strings.Count(a, "*"), strings.Count(b, "*")
+		if aw != bw {
+			return aw - bw
+		}
+		return strings.Compare(a, b)
+	})
+
+	var options []lookupOption
+	for _, key := range keys {
+		option, err := parseLookupOption(section[key])
+		if err != nil {
+			return nil, fmt.Errorf("lookup_options %s: %w", key, err)
+		}
+
+		option.segments = splitPath(key)
+		options = append(options, option)
+	}
+
+	return options, nil
+}
+
+func parseLookupOption(raw any) (lookupOption, error) {
+	var option lookupOption
+	var merge any
+
+	switch typed := raw.(type) {
+	case string:
+		merge = typed
+	case map[string]any:
+		merge = typed["merge"]
+
+		if am, ok := typed["array_merge"]; ok {
+			strategy, err := parseArrayStrategy(am)
+			if err != nil {
+				return option, err
+			}
+			option.arrayMerge = strategy
+		}
+
+		if mk, ok := typed["merge_key"]; ok {
+			key, ok := mk.(string)
+			if !ok || key == "" {
+				return option, fmt.Errorf("merge_key must be a string")
+			}
+			option.mergeKey = key
+		}
+	default:
+		return option, fmt.Errorf("must be a merge strategy or a map")
+	}
+
+	switch {
+	case option.arrayMerge == ArrayByKey && option.mergeKey == "":
+		return option, fmt.Errorf("the %s array strategy requires a merge_key", ArrayByKey)
+	case option.mergeKey != "" && option.arrayMerge != ArrayByKey:
+		return option, fmt.Errorf("merge_key requires the %s array strategy", ArrayByKey)
+	}
+
+	if m, ok := merge.(map[string]any); ok {
+		merge = m["strategy"]
+	}
+
+	if merge == nil && option.arrayMerge != "" {
+		return option, nil
+	}
+
+	strategy, ok := merge.(string)
+	if !ok {
+		return option, fmt.Errorf("merge strategy must be a string")
+	}
+
+	strategy = strings.ToLower(strategy)
+	if !slices.Contains(mergeStrategies, strategy) {
+		return option, fmt.Errorf("unknown merge strategy %q", strategy)
+	}
+	option.strategy = strategy
+
+	return option, nil
+}
+
+// parseArrayStrategy validates an array merge strategy
+func parseArrayStrategy(raw any) (string, error) {
+	strategy, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("array merge strategy must be a string")
+	}
+
+	strategy = strings.ToLower(strategy)
+	if !slices.Contains(arrayStrategies, strategy) {
+		return "", fmt.Errorf("unknown array merge strategy %q", strategy)
+	}
+
+	return strategy, nil
+}
+
+// splitPath splits a gjson style path on unescaped dots
+func splitPath(path string) []string {
+	var segments []string
+	var current strings.Builder
+
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			current.WriteByte(path[i])
+		case path[i] == '.':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(path[i])
+		}
+	}
+
+	return append(segments, current.String())
+}
+
+// merger merges layers honoring lookup options, a merger holds state about previous merges and should be used for a
+// single resolve only
+type merger struct {
+	options []lookupOption
+	// arrayMerge is the array merge strategy used when no lookup option sets one
+	arrayMerge string
+	// knockout is a prefix that marks map keys and slice entries to remove from earlier layers, empty disables it
+	knockout string
+	// set tracks the paths that were set by an override, used by the first strategy
+	set map[string]bool
+	// sliceOrigins records where the entries of every slice produced by the last merge came from keyed by the path of
+	// the slice, nil when not tracked
+	sliceOrigins map[string][]entryOrigin
+}
+
+// entryOrigin locates where an entry of a merged slice came from, an index is -1 when the entry is not from that slice
+type entryOrigin struct {
+	existing int
+	incoming int
+}
+
+// sliceEntry is an entry of a slice being merged and where it came from
+type sliceEntry struct {
+	value  any
+	origin entryOrigin
+}
+
+func newMerger(options []lookupOption, arrayMerge string, knockout string) *merger {
+	if arrayMerge == "" {
+		arrayMerge = ArrayConcat
+	}
+
+	return &merger{options: options, arrayMerge: arrayMerge, knockout: knockout, set: map[string]bool{}}
+}
+
+// trackSlices enables recording where the entries of merged slices came from
+func (m *merger) trackSlices() {
+	m.sliceOrigins = map[string][]entryOrigin{}
+}
+
+// option finds the lookup option for path
+func (m *merger) option(path []string) (lookupOption, bool) {
+	for _, option := range m.options {
+		if option.matches(path) {
+			return option, true
+		}
+	}
+
+	return lookupOption{}, false
+}
+
+// strategy finds the merge strategy for path, dflt is returned when no lookup option sets one
+func (m *merger) strategy(path []string, dflt string) string {
+	option, ok := m.option(path)
+	if !ok || option.strategy == "" {
+		return dflt
+	}
+
+	return option.strategy
+}
+
+// shallowMerge merges source keys into target without recursion unless lookup options require it.
+func (m *merger) shallowMerge(target, source map[string]any) map[string]any {
+	clear(m.sliceOrigins)
+	return m.mergeMap(nil, nil, target, source, MergeReplace)
+}
+
+// deepMerge merges source maps into target recursively. Map values are merged, slices are concatenated, and other values override.
+func (m *merger) deepMerge(target, source map[string]any) map[string]any {
+	clear(m.sliceOrigins)
+	return m.mergeMap(nil, nil, target, source, MergeDeep)
+}
+
+// layeredMerge merges the keys of source that lookup options give a strategy other than first into target and ignores
+// all other keys, in first merge mode it merges the layers after the first matching one
+func (m *merger) layeredMerge(target, source map[string]any) map[string]any {
+	clear(m.sliceOrigins)
+
+	result := cloneMap(target)
+	for key, value := range source {
+		path := []string{key}
+		strategy := m.strategy(path, MergeFirst)
+		if strategy == MergeFirst {
+			continue
+		}
+
+		existing, ok := result[key]
+		if !ok {
+			result[key] = m.cloneValue(value)
+			continue
+		}
+
+		result[key] = m.mergeValue(path, path, existing, value, strategy)
+	}
+
+	return result
+}
+
+// layered determines if any top level key has a strategy other than first and so merges layers in first merge mode
+func (m *merger) layered() bool {
+	for _, option := range m.options {
+		if len(option.segments) == 1 && option.strategy != "" && option.strategy != MergeFirst {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeMap merges every key in source into a copy of target, dflt is the strategy for keys without lookup options.
+// The path used to find lookup options has # for slice entries while at is the location in the merged data
+func (m *merger) mergeMap(path []string, at []string, target, source map[string]any, dflt string) map[string]any {
+	result := cloneMap(target)
+	for key, value := range source {
+		if knocked, ok := m.knockedOut(key); ok {
+			delete(result, knocked)
+			continue
+		}
+
+		keyPath := append(slices.Clone(path), key)
+		strategy := m.strategy(keyPath, dflt)
+
+		existing, ok := result[key]
+		if !ok && strategy != MergeFirst {
+			result[key] = m.cloneValue(value)
+			continue
+		}
+
+		result[key] = m.mergeValue(keyPath, append(slices.Clone(at), key), existing, value, strategy)
+	}
+
+	return result
+}
+
+// mergeValue merges incoming into existing using strategy
+func (m *merger) mergeValue(path []string, at []string, existing any, incoming any, strategy string) any {
+	switch strategy {
+	case MergeFirst:
+		key := strings.Join(path, "\x00")
+		if m.set[key] {
+			return existing
+		}
+		m.set[key] = true
+
+	case MergeHash:
+		existingMap, ok := existing.(map[string]any)
+		incomingMap, iok := incoming.(map[string]any)
+		if ok && iok {
+			return m.mergeMap(path, at, existingMap, incomingMap, MergeReplace)
+		}
+
+	case MergeDeep:
+		switch existingTyped := existing.(type) {
+		case map[string]any:
+			if incomingMap, ok := incoming.(map[string]any); ok {
+				return m.mergeMap(path, at, existingTyped, incomingMap, MergeDeep)
+			}
+		case []any:
+			if incomingSlice, ok := incoming.([]any); ok {
+				return m.mergeSlice(path, at, existingTyped, incomingSlice)
+			}
+		}
+
+	case MergeUnique:
+		existingSlice, ok := existing.([]any)
+		incomingSlice, iok := incoming.([]any)
+		if ok && iok {
+			return m.recordSlice(at, uniqueEntries(m.sliceEntries(existingSlice, incomingSlice)))
+		}
+	}
+
+	if incomingSlice, ok := incoming.([]any); ok {
+		_, kept := m.sliceEntries(nil, incomingSlice)
+		return m.recordSlice(at, kept)
+	}
+
+	return m.cloneValue(incoming)
+}
+
+// mergeSlice merges incoming into existing using the array strategy for path
+func (m *merger) mergeSlice(path []string, at []string, existing []any, incoming []any) []any {
+	strategy := m.arrayMerge
+	option, ok := m.option(path)
+	if ok && option.arrayMerge != "" {
+		strategy = option.arrayMerge
+	}
+
+	if strategy == ArrayByKey {
+		return m.mergeSliceByKey(path, at, existing, incoming, option.mergeKey)
+	}
+
+	existingEntries, incomingEntries := m.sliceEntries(existing, incoming)
+
+	var merged []sliceEntry
+	switch strategy {
+	case ArrayUnique:
+		merged = uniqueEntries(existingEntries, incomingEntries)
+	case ArrayReplace:
+		merged = incomingEntries
+	case ArrayPrepend:
+		merged = append(incomingEntries, existingEntries...)
+	default:
+		merged = append(existingEntries, incomingEntries...)
+	}
+
+	return m.recordSlice(at, merged)
+}
+
+// mergeSliceByKey deep merges maps in incoming into maps in existing that have the same value for key, maps with a
+// key value using the knockout prefix remove the matching map and all other entries are appended
+func (m *merger) mergeSliceByKey(path []string, at []string, existing []any, incoming []any, key string) []any {
+	type keyedEntry struct {
+		sliceEntry
+		// merges are the incoming maps to merge into the entry once its final position is known
+		merges []map[string]any
+	}
+
+	existingEntries, incomingEntries := m.sliceEntries(existing, incoming)
+
+	entries := make([]keyedEntry, len(existingEntries))
+	for i, entry := range existingEntries {
+		entries[i] = keyedEntry{sliceEntry: entry}
+	}
+
+	for _, entry := range incomingEntries {
+		item, ok := entry.value.(map[string]any)
+		if !ok {
+			entries = append(entries, keyedEntry{sliceEntry: entry})
+			continue
+		}
+
+		id, hasID := item[key]
+
+		if knocked, ok := m.knockedOut(id); ok {
+			entries = slices.DeleteFunc(entries, func(e keyedEntry) bool {
+				em, ok := e.value.(map[string]any)
+				return ok && reflect.DeepEqual(em[key], knocked)
+			})
+			continue
+		}
+
+		idx := -1
+		if hasID {
+			idx = slices.IndexFunc(entries, func(e keyedEntry) bool {
+				em, ok := e.value.(map[string]any)
+				return ok && reflect.DeepEqual(em[key], id)
+			})
+		}
+
+		if idx == -1 {
+			entries = append(entries, keyedEntry{sliceEntry: entry})
+			continue
+		}
+
+		entries[idx].merges = append(entries[idx].merges, item)
+		entries[idx].origin.incoming = entry.origin.incoming
+	}
+
+	itemPath := append(slices.Clone(path), "#")
+	merged := make([]sliceEntry, len(entries))
+	for i, entry := range entries {
+		for _, item := range entry.merges {
+			entry.value = m.mergeMap(itemPath, append(slices.Clone(at), strconv.Itoa(i)), entry.value.(map[string]any), item, MergeDeep)
+		}
+		merged[i] = entry.sliceEntry
+	}
+
+	return m.recordSlice(at, merged)
+}
+
+// recordSlice returns the values of entries and records where they came from when slice origins are tracked
+func (m *merger) recordSlice(at []string, entries []sliceEntry) []any {
+	values := make([]any, len(entries))
+	origins := make([]entryOrigin, len(entries))
+	for i, entry := range entries {
+		values[i] = entry.value
+		origins[i] = entry.origin
+	}
+
+	if m.sliceOrigins != nil {
+		m.sliceOrigins[tracePath(at)] = origins
+	}
+
+	return values
+}
+
+// knockedOut determines if value is marked for removal using the knockout prefix and returns the value to remove
+func (m *merger) knockedOut(value any) (string, bool) {
+	if m.knockout == "" {
+		return "", false
+	}
+
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, m.knockout) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(s, m.knockout), true
+}
+
+// sliceEntries removes entries marked by the knockout prefix in incoming from existing, it returns copies of the
+// entries of both slices with all knockout markers removed along with their index in the slice they came from
+func (m *merger) sliceEntries(existing []any, incoming []any) ([]sliceEntry, []sliceEntry) {
+	var knocked []any
+	kept := []sliceEntry{}
+
+	for i, value := range incoming {
+		if k, ok := m.knockedOut(value); ok {
+			knocked = append(knocked, k)
+			continue
+		}
+		kept = append(kept, sliceEntry{value: m.cloneValue(value), origin: entryOrigin{existing: -1, incoming: i}})
+	}
+
+	remaining := []sliceEntry{}
+	for i, value := range existing {
+		if !containsValue(knocked, value) {
+			remaining = append(remaining, sliceEntry{value: cloneValue(value), origin: entryOrigin{existing: i, incoming: -1}})
+		}
+	}
+
+	return remaining, kept
+}
+
+// cloneValue duplicates value like cloneValue and removes any knockout markers since there is nothing for them to remove
+func (m *merger) cloneValue(value any) any {
+	if m.knockout == "" {
+		return cloneValue(value)
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(typed))
+		for key, val := range typed {
+			if _, ok := m.knockedOut(key); ok {
+				continue
+			}
+			result[key] = m.cloneValue(val)
+		}
+		return result
+	case []any:
+		_, kept := m.sliceEntries(nil, typed)
+		values := make([]any, len(kept))
+		for i, entry := range kept {
+			values[i] = entry.value
+		}
+		return values
+	default:
+		return typed
+	}
+}
+
+// uniqueEntries combines slices preserving order and dropping entries with duplicate values
+func uniqueEntries(lists ...[]sliceEntry) []sliceEntry {
+	result := []sliceEntry{}
+	var values []any
+
+	for _, s := range lists {
+		for _, entry := range s {
+			if !containsValue(values, entry.value) {
+				values = append(values, entry.value)
+				result = append(result, entry)
+			}
+		}
+	}
+
+	return result
+}
+
+func containsValue(list []any, value any) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
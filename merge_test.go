@@ -0,0 +1,303 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("lookup_options", func() {
+	resolve := func(merge string, options map[string]any, facts map[string]any) (map[string]any, error) {
+		return Resolve(map[string]any{
+			"hierarchy": map[string]any{
+				"order": []any{"env:{{ lookup('env') }}", "role:{{ lookup('role') }}"},
+				"merge": merge,
+			},
+			"lookup_options": options,
+			"data": map[string]any{
+				"packages": []any{"ca-certificates", "nginx"},
+				"web": map[string]any{
+					"listen_port": 80,
+					"tls":         map[string]any{"enabled": false, "ciphers": "default"},
+				},
+				"users": map[string]any{
+					"root": map[string]any{"shell": "/bin/sh"},
+				},
+			},
+			"overrides": map[string]any{
+				"env:prod": map[string]any{
+					"packages": []any{"nginx", "curl"},
+					"web": map[string]any{
+						"listen_port": 443,
+						"tls":         map[string]any{"enabled": true},
+					},
+					"users": map[string]any{
+						"root": map[string]any{"uid": 0},
+					},
+				},
+				"role:web": map[string]any{
+					"packages": []any{"haproxy"},
+					"web": map[string]any{
+						"listen_port": 8443,
+					},
+				},
+			},
+		}, facts, DefaultOptions, nil)
+	}
+
+	prod := map[string]any{"env": "prod", "role": "web"}
+
+	It("Should combine slices without duplicates using unique", func() {
+		result, err := resolve("deep", map[string]any{"packages": map[string]any{"merge": "unique"}}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["packages"]).To(Equal([]any{"ca-certificates", "nginx", "curl", "haproxy"}))
+	})
+
+	It("Should replace values using replace", func() {
+		result, err := resolve("deep", map[string]any{"packages": "replace"}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["packages"]).To(Equal([]any{"haproxy"}))
+	})
+
+	It("Should keep the first override using first", func() {
+		result, err := resolve("deep", map[string]any{"web.listen_port": map[string]any{"merge": "first"}}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["web"]).To(Equal(map[string]any{
+			"listen_port": 443,
+			"tls":         map[string]any{"enabled": true, "ciphers": "default"},
+		}))
+	})
+
+	It("Should merge one level deep using hash", func() {
+		result, err := resolve("deep", map[string]any{"web": map[string]any{"merge": map[string]any{"strategy": "hash"}}}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["web"]).To(Equal(map[string]any{
+			"listen_port": 8443,
+			"tls":         map[string]any{"enabled": true},
+		}))
+	})
+
+	It("Should support wildcard paths", func() {
+		result, err := resolve("first", map[string]any{"users": "deep", "users.*": "deep"}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["users"]).To(Equal(map[string]any{
+			"root": map[string]any{"shell": "/bin/sh", "uid": 0},
+		}))
+	})
+
+	It("Should honor options in first merge mode", func() {
+		result, err := resolve("first", map[string]any{"web": "deep"}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(map[string]any{
+			"packages": []any{"nginx", "curl"},
+			"web": map[string]any{
+				"listen_port": 8443,
+				"tls":         map[string]any{"enabled": true, "ciphers": "default"},
+			},
+			"users": map[string]any{
+				"root": map[string]any{"uid": 0},
+			},
+		}))
+	})
+
+	It("Should merge later layers for keys with their own strategy in first merge mode", func() {
+		result, err := resolve("first", map[string]any{"packages": "unique", "web.listen_port": "replace"}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(map[string]any{
+			"packages": []any{"ca-certificates", "nginx", "curl", "haproxy"},
+			"web": map[string]any{
+				"listen_port": 443,
+				"tls":         map[string]any{"enabled": true},
+			},
+			"users": map[string]any{
+				"root": map[string]any{"uid": 0},
+			},
+		}))
+
+		result, err = resolve("first", map[string]any{"packages": "first"}, prod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["packages"]).To(Equal([]any{"nginx", "curl"}))
+	})
+
+	It("Should reject unknown strategies", func() {
+		_, err := resolve("deep", map[string]any{"packages": "other"}, prod)
+		Expect(err).To(MatchError(`lookup_options packages: unknown merge strategy "other"`))
+	})
+})
+
+var _ = Describe("splitPath", func() {
+	It("Should split on unescaped dots", func() {
+		Expect(splitPath("web.listen_port")).To(Equal([]string{"web", "listen_port"}))
+		Expect(splitPath(`web\.host.port`)).To(Equal([]string{"web.host", "port"}))
+		Expect(splitPath("web")).To(Equal([]string{"web"}))
+	})
+})
+
+var _ = Describe("knockout_prefix", func() {
+	doc := func(prefix string) map[string]any {
+		return map[string]any{
+			"hierarchy": map[string]any{
+				"order":           []any{"env:{{ lookup('env') }}", "role:{{ lookup('role') }}"},
+				"merge":           "deep",
+				"knockout_prefix": prefix,
+			},
+			"data": map[string]any{
+				"packages": []any{"ca-certificates", "nginx", "curl"},
+				"flags":    []any{"--verbose"},
+				"web": map[string]any{
+					"listen_port": 80,
+					"tls":         map[string]any{"enabled": false, "ciphers": "default"},
+					"vhosts":      []any{"www", "api"},
+				},
+				"debug": true,
+			},
+			"overrides": map[string]any{
+				"env:prod": map[string]any{
+					"--debug": nil,
+					"web": map[string]any{
+						"tls":    map[string]any{"--ciphers": nil},
+						"vhosts": []any{"--api", "admin"},
+					},
+				},
+				"role:web": map[string]any{
+					"packages": []any{"--nginx", "haproxy"},
+					"extra":    map[string]any{"--removed": nil, "kept": true, "list": []any{"--x", "y"}},
+				},
+			},
+		}
+	}
+
+	It("Should remove keys and slice entries marked with the prefix", func() {
+		result, err := Resolve(doc("--"), map[string]any{"env": "prod", "role": "web"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(map[string]any{
+			"packages": []any{"ca-certificates", "curl", "haproxy"},
+			"flags":    []any{"--verbose"},
+			"web": map[string]any{
+				"listen_port": 80,
+				"tls":         map[string]any{"enabled": false},
+				"vhosts":      []any{"www", "admin"},
+			},
+			"extra": map[string]any{"kept": true, "list": []any{"y"}},
+		}))
+	})
+
+	It("Should honor knockouts with the unique strategy", func() {
+		root := doc("!!")
+		root["lookup_options"] = map[string]any{"packages": "unique"}
+		root["overrides"].(map[string]any)["role:web"] = map[string]any{
+			"packages": []any{"!!nginx", "curl", "haproxy"},
+		}
+
+		result, err := Resolve(root, map[string]any{"role": "web"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["packages"]).To(Equal([]any{"ca-certificates", "curl", "haproxy"}))
+	})
+
+	It("Should remove top level keys in first merge mode", func() {
+		root := doc("--")
+		root["hierarchy"].(map[string]any)["merge"] = "first"
+
+		result, err := Resolve(root, map[string]any{"env": "prod"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(HaveKey("debug"))
+		Expect(result["web"]).To(Equal(map[string]any{
+			"tls":    map[string]any{},
+			"vhosts": []any{"admin"},
+		}))
+	})
+
+	It("Should be disabled by default", func() {
+		result, err := Resolve(doc(""), map[string]any{"role": "web"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["packages"]).To(Equal([]any{"ca-certificates", "nginx", "curl", "--nginx", "haproxy"}))
+	})
+})
+
+var _ = Describe("array_merge", func() {
+	doc := func(arrayMerge string, options map[string]any) map[string]any {
+		return map[string]any{
+			"hierarchy": map[string]any{
+				"order":           []any{"env:{{ lookup('env') }}", "role:{{ lookup('role') }}"},
+				"merge":           "deep",
+				"array_merge":     arrayMerge,
+				"knockout_prefix": "--",
+			},
+			"lookup_options": options,
+			"data": map[string]any{
+				"packages": []any{"ca-certificates", "nginx"},
+				"users": []any{
+					map[string]any{"name": "root", "shell": "/bin/sh"},
+					map[string]any{"name": "bob", "groups": []any{"users"}},
+					map[string]any{"name": "eve"},
+				},
+			},
+			"overrides": map[string]any{
+				"env:prod": map[string]any{
+					"packages": []any{"nginx", "curl"},
+				},
+				"role:web": map[string]any{
+					"packages": []any{"nginx"},
+					"users": []any{
+						map[string]any{"name": "bob", "groups": []any{"wheel"}, "shell": "/bin/zsh"},
+						map[string]any{"name": "--eve"},
+						map[string]any{"name": "www"},
+						"plain",
+					},
+				},
+			},
+		}
+	}
+
+	facts := map[string]any{"env": "prod", "role": "web"}
+
+	DescribeTable("global array strategies",
+		func(strategy string, expected []any) {
+			result, err := Resolve(doc(strategy, nil), facts, DefaultOptions, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result["packages"]).To(Equal(expected))
+		},
+		Entry("default", "", []any{"ca-certificates", "nginx", "nginx", "curl", "nginx"}),
+		Entry("concat", "concat", []any{"ca-certificates", "nginx", "nginx", "curl", "nginx"}),
+		Entry("unique", "unique", []any{"ca-certificates", "nginx", "curl"}),
+		Entry("replace", "replace", []any{"nginx"}),
+		Entry("prepend", "prepend", []any{"nginx", "nginx", "curl", "ca-certificates", "nginx"}),
+	)
+
+	It("Should merge maps in slices by key", func() {
+		result, err := Resolve(doc("unique", map[string]any{
+			"users": map[string]any{"array_merge": "by_key", "merge_key": "name"},
+		}), facts, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["packages"]).To(Equal([]any{"ca-certificates", "nginx", "curl"}))
+		Expect(result["users"]).To(Equal([]any{
+			map[string]any{"name": "root", "shell": "/bin/sh"},
+			map[string]any{"name": "bob", "groups": []any{"users", "wheel"}, "shell": "/bin/zsh"},
+			map[string]any{"name": "www"},
+			"plain",
+		}))
+	})
+
+	It("Should honor lookup options for keys inside slice entries", func() {
+		result, err := Resolve(doc("", map[string]any{
+			"users":          map[string]any{"array_merge": "by_key", "merge_key": "name"},
+			"users.#.groups": map[string]any{"array_merge": "replace"},
+		}), facts, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["users"].([]any)[1]).To(Equal(map[string]any{"name": "bob", "groups": []any{"wheel"}, "shell": "/bin/zsh"}))
+	})
+
+	It("Should validate array strategies", func() {
+		_, err := Resolve(doc("other", nil), facts, DefaultOptions, nil)
+		Expect(err).To(MatchError(`hierarchy.array_merge: unknown array merge strategy "other"`))
+
+		_, err = Resolve(doc("by_key", nil), facts, DefaultOptions, nil)
+		Expect(err).To(MatchError("hierarchy.array_merge: the by_key array strategy can only be set in lookup_options"))
+
+		_, err = Resolve(doc("", map[string]any{"users": map[string]any{"array_merge": "by_key"}}), facts, DefaultOptions, nil)
+		Expect(err).To(MatchError("lookup_options users: the by_key array strategy requires a merge_key"))
+	})
+})
@@ -0,0 +1,126 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// capturesVariable is the expression variable holding the match and capture groups of an override pattern
+const capturesVariable = "captures"
+
+// overridePattern is an override whose key is a glob like host:web* or a regular expression like /^host:web\d+$/
+type overridePattern struct {
+	// key is the override key as written in the document
+	key string
+	// re matches the entire interpolated order entry
+	re *regexp.Regexp
+	// regex indicates the key is a regular expression rather than a glob
+	regex bool
+	// rank is the number of literal characters in a glob or the length of the literal prefix of a regular expression
+	rank int
+	// value is the compiled override
+	value map[string]any
+}
+
+// isOverridePattern determines if an override key is a glob or regular expression rather than an exact key
+func isOverridePattern(key string) bool {
+	return isRegexKey(key) || strings.ContainsAny(key, "*?")
+}
+
+func isRegexKey(key string) bool {
+	return len(key) > 2 && strings.HasPrefix(key, "/") && strings.HasSuffix(key, "/")
+}
+
+// compileOverridePattern compiles a glob or regular expression override key, * and ? in globs are capture groups
+func compileOverridePattern(key string, value map[string]any) (*overridePattern, error) {
+	p := &overridePattern{key: key, value: value}
+
+	if isRegexKey(key) {
+		source := key[1 : len(key)-1]
+
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("override %s: %w", key, err)
+		}
+		prefix, _ := re.LiteralPrefix()
+
+		p.regex = true
+		p.rank = len(prefix)
+		p.re, err = regexp.Compile(`^(?:` + source + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("override %s: %w", key, err)
+		}
+
+		return p, nil
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, c := range key {
+		switch c {
+		case '*':
+			pattern.WriteString("(.*)")
+		case '?':
+			pattern.WriteString("(.)")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+			p.rank++
+		}
+	}
+	pattern.WriteString("$")
+
+	p.re = regexp.MustCompile(pattern.String())
+
+	return p, nil
+}
+
+// sortOverridePatterns orders patterns by precedence, globs come before regular expressions and the most specific
+// pattern comes first within each with ties ordered by key
+func sortOverridePatterns(patterns []*overridePattern) {
+	slices.SortFunc(patterns, func(a, b *overridePattern) int {
+		switch {
+		case a.regex != b.regex && !a.regex:
+			return -1
+		case a.regex != b.regex:
+			return 1
+		case a.rank != b.rank:
+			return b.rank - a.rank
+		default:
+			return strings.Compare(a.key, b.key)
+		}
+	})
+}
+
+// findOverride finds the override selected by an interpolated order entry, exact keys take precedence over patterns.
+// For patterns the environment gets a captures variable holding the match and its capture groups
+func (r *Resolver) findOverride(resolvedKey string, env map[string]any) (string, map[string]any, map[string]any, bool) {
+	if compiled, ok := r.overrides[resolvedKey]; ok {
+		return resolvedKey, compiled, env, true
+	}
+
+	for _, p := range r.patterns {
+		m := p.re.FindStringSubmatch(resolvedKey)
+		if m == nil {
+			continue
+		}
+
+		captures := make([]any, len(m))
+		for i, v := range m {
+			captures[i] = v
+		}
+
+		penv := maps.Clone(env)
+		penv[capturesVariable] = captures
+
+		return p.key, p.value, penv, true
+	}
+
+	return "", nil, nil, false
+}
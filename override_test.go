@@ -0,0 +1,125 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Override patterns", func() {
+	doc := []byte(`
+hierarchy:
+  order:
+    - host:{{ lookup('hostname') }}
+  merge: deep
+
+data:
+  role: unknown
+  source: data
+
+overrides:
+  host:db01:
+    source: exact
+
+  host:web*:
+    role: web
+    source: "glob {{ captures[1] }}"
+
+  host:w*:
+    source: short glob
+
+  "/^host:(web|db)(\\d+)$/":
+    role: "{{ captures[1] }}"
+    index: "{{ int(captures[2]) }}"
+    source: regex
+`)
+
+	resolve := func(hostname string) map[string]any {
+		resolver, err := NewYaml(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := resolver.Resolve(context.Background(), map[string]any{"hostname": hostname})
+		Expect(err).NotTo(HaveOccurred())
+
+		return res
+	}
+
+	It("Should prefer exact keys", func() {
+		Expect(resolve("db01")).To(Equal(map[string]any{"role": "unknown", "source": "exact"}))
+	})
+
+	It("Should prefer the most specific glob with captures", func() {
+		Expect(resolve("web01")).To(Equal(map[string]any{"role": "web", "source": "glob 01"}))
+		Expect(resolve("www")).To(Equal(map[string]any{"role": "unknown", "source": "short glob"}))
+	})
+
+	It("Should match anchored regular expressions with captures", func() {
+		Expect(resolve("db02")).To(Equal(map[string]any{"role": "db", "index": 2, "source": "regex"}))
+		Expect(resolve("db02x")).To(Equal(map[string]any{"role": "unknown", "source": "data"}))
+	})
+
+	It("Should order patterns deterministically", func() {
+		var patterns []*overridePattern
+		for _, key := range []string{"/^a.*$/", "a*", "/^abc/", "ab?", "b*", "abc*"} {
+			p, err := compileOverridePattern(key, nil)
+			Expect(err).NotTo(HaveOccurred())
+			patterns = append(patterns, p)
+		}
+		sortOverridePatterns(patterns)
+
+		var keys []string
+		for _, p := range patterns {
+			keys = append(keys, p.key)
+		}
+		Expect(keys).To(Equal([]string{"abc*", "ab?", "a*", "b*", "/^abc/", "/^a.*$/"}))
+	})
+
+	It("Should keep captures for expressions using data()", func() {
+		root := map[string]any{
+			"hierarchy": map[string]any{"order": []any{"host:{{ lookup('hostname') }}"}, "merge": "deep"},
+			"data":      map[string]any{"base": 10},
+			"overrides": map[string]any{
+				"host:web*": map[string]any{"port": "{{ data('base') + int(captures[1]) }}"},
+			},
+		}
+
+		for _, strict := range []bool{false, true} {
+			res, _, err := ResolveWithTrace(root, map[string]any{"hostname": "web01"}, Options{DataKey: "data", Strict: strict}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(map[string]any{"base": 10, "port": 11}))
+		}
+	})
+
+	It("Should trace the interpolated key and the matching pattern", func() {
+		resolver, err := NewYaml(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, trace, err := resolver.ResolveWithTrace(context.Background(), map[string]any{"hostname": "web01"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trace).To(ContainElement(TraceEntry{
+			Path:       "source",
+			TraceLayer: TraceLayer{Layer: "host:web01", Entry: "host:{{ lookup('hostname') }}", Pattern: "host:web*", Value: "glob 01"},
+			Shadowed:   []TraceLayer{{Layer: "data", Value: "data"}},
+		}))
+
+		_, trace, err = resolver.ResolveWithTrace(context.Background(), map[string]any{"hostname": "db01"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trace).To(ContainElement(TraceEntry{
+			Path:       "source",
+			TraceLayer: TraceLayer{Layer: "host:db01", Entry: "host:{{ lookup('hostname') }}", Value: "exact"},
+			Shadowed:   []TraceLayer{{Layer: "data", Value: "data"}},
+		}))
+	})
+
+	It("Should report invalid regular expressions", func() {
+		_, err := New(map[string]any{
+			"overrides": map[string]any{"/x(/": map[string]any{}},
+		}, DefaultOptions)
+		Expect(err).To(MatchError("override /x(/: error parsing regexp: missing closing ): `x(`"))
+	})
+})
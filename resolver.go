@@ -5,14 +5,13 @@
 package tinyhiera
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
-	"regexp"
-	"slices"
+	"strconv"
 	"strings"
 
-	"github.com/expr-lang/expr"
 	"github.com/goccy/go-yaml"
 	"github.com/tidwall/gjson"
 )
@@ -20,13 +19,33 @@ import (
 // Hierarchy describes how data sections should be resolved.
 type Hierarchy struct {
 	// Order defines the lookup sequence for data sections.
-	Order []string `yaml:"order"`
+	Order []OrderEntry `yaml:"order"`
 	// Merge selects the merge strategy ("first" or "deep").
 	Merge string `yaml:"merge"`
+	// ArrayMerge selects how slices are combined by the deep merge strategy, defaults to "concat".
+	ArrayMerge string `yaml:"array_merge"`
+	// KnockoutPrefix marks map keys and slice entries in overrides that remove the matching data from earlier layers.
+	KnockoutPrefix string `yaml:"knockout_prefix"`
 }
 
+// OrderEntry is an entry in the hierarchy order, in the document it is either a string holding the name or a map
+type OrderEntry struct {
+	// Name is the override to apply, it may hold placeholders
+	Name string `yaml:"name"`
+	// When is an expression that has to be true for the entry to apply, the entry always applies when empty
+	When string `yaml:"when"`
+}
+
+// Options configures the resolver
 type Options struct {
+	// DataKey is the key holding the base data, defaults to "data"
 	DataKey string
+	// Logger receives debug messages during resolution, may be nil
+	Logger Logger
+	// Schema is a JSON Schema the resolved data must match, it replaces any schema section in the document
+	Schema map[string]any
+	// Strict makes using an undefined fact without a default in an expression an error
+	Strict bool
 }
 
 var DefaultOptions = Options{
@@ -47,25 +66,81 @@ var (
 // Resolve consumes a parsed data document and a map of facts to produce a final data map.
 // The data map is expected to contain a hierarchy section, a base data section, and any number of overlays.
 // Placeholders in the hierarchy order (e.g. env:%{env}) are replaced with values from the provided facts map.
+//
+// The document is compiled on every call, use New to compile it once when resolving it many times.
 func Resolve(root map[string]any, facts map[string]any, opts Options, log Logger) (map[string]any, error) {
-	if opts.DataKey == "" {
-		opts.DataKey = "data"
+	if log != nil {
+		opts.Logger = log
 	}
 
-	_, ok := root["hierarchy"]
-	if !ok {
-		root["hierarchy"] = DefaultHierarchy
+	resolver, err := New(root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolver.Resolve(context.Background(), facts)
+}
+
+// ResolveYaml consumes raw YAML bytes and a map of facts to produce a final data map.
+// The function decodes the YAML document and delegates processing to Resolve to perform merges and fact substitution.
+func ResolveYaml(data []byte, facts map[string]any, opts Options, log Logger) (map[string]any, error) {
+	root := map[string]any{}
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	return Resolve(root, facts, opts, log)
+}
+
+// ResolveJson consumes raw JSON bytes and a map of facts to produce a final data map.
+// The function decodes the JSON document and delegates processing to Resolve to perform merges and fact substitution.
+func ResolveJson(data []byte, facts map[string]any, opts Options, log Logger) (map[string]any, error) {
+	root := map[string]any{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	return Resolve(root, facts, opts, log)
+}
+
+// Resolver is a hierarchy document that was parsed and compiled once so it can be resolved against many sets of facts.
+// A Resolver is safe for concurrent use.
+type Resolver struct {
+	opts          Options
+	mergeMode     string
+	arrayMerge    string
+	knockout      string
+	order         []*orderEntry
+	data          map[string]any
+	hasData       bool
+	overrides     map[string]map[string]any
+	patterns      []*overridePattern
+	lookupOptions []lookupOption
+	schema        *schema
+	derived       []derivedFact
+	// refsData indicates the data or overrides call data() and need a final evaluation pass after merging
+	refsData bool
+}
+
+// New parses and compiles a data document, all hierarchy and data expressions are compiled and errors are reported here
+func New(root map[string]any, opts Options) (*Resolver, error) {
+	if opts.DataKey == "" {
+		opts.DataKey = "data"
 	}
 
 	normalizedRoot, ok := normalizeNumericValues(root).(map[string]any)
 	if !ok {
 		return nil, fmt.Errorf("root document must be a map")
 	}
-
 	root = normalizedRoot
-	var overrides map[string]any
-	if _, ok := root["overrides"]; ok {
-		overrides = root["overrides"].(map[string]any)
+
+	if _, ok := root["imports"]; ok {
+		return nil, fmt.Errorf("imports can only be used in documents read using Load")
+	}
+
+	_, ok = root["hierarchy"]
+	if !ok {
+		root["hierarchy"] = DefaultHierarchy
 	}
 
 	hierarchy, err := parseHierarchy(root)
@@ -73,82 +148,286 @@ func Resolve(root map[string]any, facts map[string]any, opts Options, log Logger
 		return nil, err
 	}
 
-	base := map[string]any{}
-	data, hasData := root[opts.DataKey].(map[string]any)
-	if hasData {
-		base, err = expandMapExprValues(cloneMap(data), facts)
+	r := &Resolver{
+		opts:      opts,
+		mergeMode: strings.ToLower(hierarchy.Merge),
+		knockout:  hierarchy.KnockoutPrefix,
+		overrides: map[string]map[string]any{},
+	}
+
+	switch r.mergeMode {
+	case "":
+		r.mergeMode = "first"
+	case "first", "deep":
+	default:
+		return nil, fmt.Errorf("unsupported merge mode: %s", hierarchy.Merge)
+	}
+
+	if hierarchy.ArrayMerge != "" {
+		r.arrayMerge, err = parseArrayStrategy(hierarchy.ArrayMerge)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("hierarchy.array_merge: %w", err)
+		}
+		if r.arrayMerge == ArrayByKey {
+			return nil, fmt.Errorf("hierarchy.array_merge: the %s array strategy can only be set in lookup_options", ArrayByKey)
 		}
 	}
 
-	mergeMode := strings.ToLower(hierarchy.Merge)
-	if mergeMode == "" {
-		mergeMode = "first"
+	r.lookupOptions, err = parseLookupOptions(root["lookup_options"])
+	if err != nil {
+		return nil, err
 	}
 
-	for _, entry := range hierarchy.Order {
-		resolvedKey, matched, err := applyFactsString(entry, facts)
+	var rawSchema any = root["schema"]
+	if opts.Schema != nil {
+		rawSchema = normalizeNumericValues(opts.Schema)
+	}
+	if rawSchema != nil {
+		r.schema, err = compileSchema(rawSchema)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		if !matched {
-			continue
-		}
+	r.derived, err = compileDerivedFacts(root["facts"])
+	if err != nil {
+		return nil, err
+	}
 
-		if log != nil {
-			log.Debug("Evaluating override", "override", resolvedKey)
+	for _, entry := range hierarchy.Order {
+		compiled, err := compileOrderEntry(entry)
+		if err != nil {
+			return nil, err
 		}
+		r.order = append(r.order, compiled)
+	}
 
-		candidateKey := resolvedKey
-		if candidateKey == opts.DataKey && hasData {
-			continue
+	data, hasData := root[opts.DataKey].(map[string]any)
+	if hasData {
+		compiled, err := compileValue(data)
+		if err != nil {
+			return nil, err
 		}
-		candidate, ok := overrides[candidateKey].(map[string]any)
+		r.data = compiled.(map[string]any)
+		r.hasData = true
+		r.refsData = refsData(r.data)
+	}
+
+	if raw, ok := root["overrides"]; ok {
+		overrides, ok := raw.(map[string]any)
 		if !ok {
-			continue
+			return nil, fmt.Errorf("overrides must be a map")
 		}
 
-		candidate, err = expandMapExprValues(cloneMap(candidate), facts)
-		if err != nil {
-			return nil, err
-		}
+		for key, value := range overrides {
+			candidate, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
 
-		switch mergeMode {
-		case "deep":
-			base = deepMerge(base, candidate)
-		case "first":
-			base = shallowMerge(base, candidate)
-			return base, nil
-		default:
-			return nil, fmt.Errorf("unsupported merge mode: %s", mergeMode)
+			compiled, err := compileValue(candidate)
+			if err != nil {
+				return nil, fmt.Errorf("override %s: %w", key, err)
+			}
+			r.refsData = r.refsData || refsData(compiled)
+
+			if !isOverridePattern(key) {
+				r.overrides[key] = compiled.(map[string]any)
+				continue
+			}
+
+			pattern, err := compileOverridePattern(key, compiled.(map[string]any))
+			if err != nil {
+				return nil, err
+			}
+			r.patterns = append(r.patterns, pattern)
 		}
+		sortOverridePatterns(r.patterns)
 	}
 
-	return base, nil
+	return r, nil
 }
 
-// ResolveYaml consumes raw YAML bytes and a map of facts to produce a final data map.
-// The function decodes the YAML document and delegates processing to Resolve to perform merges and fact substitution.
-func ResolveYaml(data []byte, facts map[string]any, opts Options, log Logger) (map[string]any, error) {
+// NewYaml parses a YAML data document and compiles it using New
+func NewYaml(data []byte, opts Options) (*Resolver, error) {
 	root := map[string]any{}
 	if err := yaml.Unmarshal(data, &root); err != nil {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
 
-	return Resolve(root, facts, opts, log)
+	return New(root, opts)
 }
 
-// ResolveJson consumes raw JSON bytes and a map of facts to produce a final data map.
-// The function decodes the JSON document and delegates processing to Resolve to perform merges and fact substitution.
-func ResolveJson(data []byte, facts map[string]any, opts Options, log Logger) (map[string]any, error) {
+// NewJson parses a JSON data document and compiles it using New
+func NewJson(data []byte, opts Options) (*Resolver, error) {
 	root := map[string]any{}
 	if err := json.Unmarshal(data, &root); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
-	return Resolve(root, facts, opts, log)
+	return New(root, opts)
+}
+
+// Resolve evaluates the compiled document against facts to produce a final data map
+func (r *Resolver) Resolve(ctx context.Context, facts map[string]any) (map[string]any, error) {
+	return r.resolve(ctx, facts, nil)
+}
+
+// resolve evaluates the compiled document and validates the result, when trace is not nil every merged layer is recorded in it
+func (r *Resolver) resolve(ctx context.Context, facts map[string]any, trace *tracer) (map[string]any, error) {
+	res, err := r.merge(ctx, facts, trace, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.schema == nil {
+		return res, nil
+	}
+
+	violations := r.schema.validate(nil, res)
+	if len(violations) == 0 {
+		return res, nil
+	}
+
+	// tracing is only done when needed to find the layers that introduced the violations
+	if trace == nil {
+		trace = newTracer()
+		_, err = r.merge(ctx, facts, trace, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	attributeViolations(violations, trace.entries())
+
+	return nil, &SchemaError{Violations: violations}
+}
+
+// merge evaluates the compiled document and merges all matching layers, when trace is not nil every merged layer is recorded in it.
+// When key is not nil only the branch of every layer leading to the key is evaluated and merged.
+func (r *Resolver) merge(ctx context.Context, facts map[string]any, trace *tracer, key *lookupKey) (map[string]any, error) {
+	env, err := deriveFacts(r.derived, facts, r.opts.Strict)
+	if err != nil {
+		return nil, err
+	}
+
+	base := map[string]any{}
+	if r.hasData {
+		res, err := evalValue(key.prune(r.data, r.knockout), env)
+		if err != nil {
+			return nil, undefinedAt(err, r.opts.DataKey)
+		}
+		base = res.(map[string]any)
+	}
+
+	if trace != nil {
+		trace.record(r.opts.DataKey, "", "", map[string]any{}, base, base, nil)
+	}
+
+	merger := newMerger(key.options(r.lookupOptions), r.arrayMerge, r.knockout)
+	if trace != nil {
+		merger.trackSlices()
+	}
+
+	// in first merge mode only keys with their own strategy are merged from layers after the first
+	firstMerged := false
+
+order:
+	for i, entry := range r.order {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		applies, err := entry.applies(env)
+		if err != nil {
+			return nil, undefinedAt(err, "hierarchy", "order", strconv.Itoa(i))
+		}
+
+		if !applies {
+			continue
+		}
+
+		resolvedKeys, err := entry.name.evalCandidates(env)
+		if err != nil {
+			return nil, undefinedAt(err, "hierarchy", "order", strconv.Itoa(i))
+		}
+
+		for _, resolvedKey := range resolvedKeys {
+			if r.opts.Logger != nil {
+				r.opts.Logger.Debug("Evaluating override", "override", resolvedKey)
+			}
+
+			if resolvedKey == r.opts.DataKey && r.hasData {
+				continue
+			}
+
+			overrideKey, compiled, overrideEnv, ok := r.findOverride(resolvedKey, env)
+			if !ok {
+				continue
+			}
+
+			res, err := evalValue(key.prune(compiled, r.knockout), overrideEnv)
+			if err != nil {
+				return nil, undefinedAt(err, "overrides", overrideKey)
+			}
+			candidate := res.(map[string]any)
+
+			var merged map[string]any
+			switch {
+			case r.mergeMode == "deep":
+				merged = merger.deepMerge(base, candidate)
+			case firstMerged:
+				merged = merger.layeredMerge(base, candidate)
+			default:
+				merged = merger.shallowMerge(base, candidate)
+			}
+
+			if trace != nil {
+				pattern := ""
+				if overrideKey != resolvedKey {
+					pattern = overrideKey
+				}
+				trace.record(resolvedKey, entry.name.source, pattern, base, merged, candidate, merger.sliceOrigins)
+			}
+
+			base = merged
+
+			if r.mergeMode == "first" {
+				firstMerged = true
+				if !merger.layered() {
+					break order
+				}
+			}
+		}
+	}
+
+	if !r.refsData {
+		return base, nil
+	}
+
+	refs := newDataRefs(base, env, key.activeRefs())
+	if key != nil {
+		refs.branch = key.segments
+		refs.fetch = func(path []string) (any, bool, error) {
+			res, err := r.merge(ctx, facts, nil, &lookupKey{segments: path, active: refs.active})
+			if err != nil {
+				return nil, false, err
+			}
+
+			value, found := valueAt(res, path)
+			return value, found, nil
+		}
+	}
+
+	err = refs.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	if trace != nil {
+		trace.resolveTemplates(base)
+	}
+
+	return base, nil
 }
 
 // parseHierarchy extracts the hierarchy definition from the raw YAML map.
@@ -164,21 +443,52 @@ func parseHierarchy(root map[string]any) (Hierarchy, error) {
 		return Hierarchy{}, fmt.Errorf("hierarchy.order must be a list")
 	}
 
-	order := make([]string, 0, len(orderSlice))
-	for _, item := range orderSlice {
-		text, ok := item.(string)
-		if !ok {
-			return Hierarchy{}, fmt.Errorf("hierarchy.order must contain only strings")
+	order := make([]OrderEntry, 0, len(orderSlice))
+	for i, item := range orderSlice {
+		switch typed := item.(type) {
+		case string:
+			order = append(order, OrderEntry{Name: typed})
+
+		case map[string]any:
+			var entry OrderEntry
+			for key, value := range typed {
+				text, ok := value.(string)
+				switch {
+				case key != "name" && key != "when":
+					return Hierarchy{}, fmt.Errorf("hierarchy.order.%d: unknown key %q", i, key)
+				case !ok:
+					return Hierarchy{}, fmt.Errorf("hierarchy.order.%d: %s must be a string", i, key)
+				case key == "name":
+					entry.Name = text
+				default:
+					entry.When = text
+				}
+			}
+			if entry.Name == "" {
+				return Hierarchy{}, fmt.Errorf("hierarchy.order.%d: name is required", i)
+			}
+			order = append(order, entry)
+
+		default:
+			return Hierarchy{}, fmt.Errorf("hierarchy.order must contain only strings or maps with a name and when")
 		}
-		order = append(order, text)
 	}
 
 	mergeMode, _ := raw["merge"].(string)
+	arrayMerge, _ := raw["array_merge"].(string)
+	knockoutPrefix, _ := raw["knockout_prefix"].(string)
+
+	return Hierarchy{Order: order, Merge: mergeMode, ArrayMerge: arrayMerge, KnockoutPrefix: knockoutPrefix}, nil
+}
 
-	return Hierarchy{Order: order, Merge: mergeMode}, nil
+func genExprEnv(facts map[string]any, strict bool) (map[string]any, error) {
+	env, _, err := genOverlayExprEnv(facts, strict)
+	return env, err
 }
 
-func genExprEnv(facts map[string]any) (map[string]any, error) {
+// genOverlayExprEnv creates the expression environment like genExprEnv and a function adding facts to it, lookup()
+// finds added facts before the facts the environment was created with so those are only marshalled once
+func genOverlayExprEnv(facts map[string]any, strict bool) (map[string]any, func(name string, value any) error, error) {
 	env := cloneMap(facts)
 
 	// do not try to json marshal these functions
@@ -186,9 +496,11 @@ func genExprEnv(facts map[string]any) (map[string]any, error) {
 
 	j, err := json.Marshal(env)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	overlay := map[string][]byte{}
+
 	env["lookup"] = func(key string, args ...any) (any, error) {
 		var dflt any
 		if len(args) >= 1 {
@@ -197,8 +509,15 @@ func genExprEnv(facts map[string]any) (map[string]any, error) {
 			dflt = ""
 		}
 
-		res := gjson.GetBytes(j, key)
+		res, found := lookupOverlay(overlay, key)
+		if !found {
+			res = gjson.GetBytes(j, key)
+		}
+
 		if !res.Exists() {
+			if strict && len(args) == 0 {
+				return nil, &UndefinedFactError{Fact: key}
+			}
 			return dflt, nil
 		}
 
@@ -213,141 +532,73 @@ func genExprEnv(facts map[string]any) (map[string]any, error) {
 		return res.Value(), nil
 	}
 
-	return env, nil
-}
-
-func applyFactsTyped(template string, facts map[string]any) (any, error) {
-	re := regexp.MustCompile(`{{\s*(.*?)\s*}}`)
-	trimmed := strings.TrimSpace(template)
-
-	matches := re.FindAllStringSubmatch(template, -1)
-	switch {
-	case matches == nil:
-		return template, nil
-	case len(matches) == 1 && strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}"):
-		return exprParse(matches[0][1], facts)
-	default:
-		res, _, err := applyFactsString(template, facts)
-		return res, err
+	if strict {
+		env[strictEnvKey] = true
 	}
-}
-
-// applyFactsString parses {{ expression}} placeholders using expr and replace them with the resulting values
-func applyFactsString(template string, facts map[string]any) (string, bool, error) {
-	// Matches: {{ something }}
-	// Capture group 1 = inner text
-	re := regexp.MustCompile(`{{\s*(.*?)\s*}}`)
 
-	out := template
-
-	matches := re.FindAllStringSubmatchIndex(template, -1)
-	if matches == nil {
-		// nothing to replace so we report that we matched because this string should be used for those who care about matching
-		return template, template != "", nil
-	}
-
-	// We will build the output incrementally
-	var result strings.Builder
-	lastIndex := 0
-	var matched []bool
-
-	for _, loc := range matches {
-		fullStart, fullEnd := loc[0], loc[1]
-		innerStart, innerEnd := loc[2], loc[3]
-
-		innerExpr := template[innerStart:innerEnd]
-
-		value, err := exprParse(innerExpr, facts)
+	add := func(name string, value any) error {
+		raw, err := json.Marshal(value)
 		if err != nil {
-			return "", false, err
+			return err
 		}
 
-		switch value.(type) {
-		case string:
-			if value == "" {
-				matched = append(matched, false)
-			} else {
-				matched = append(matched, true)
-			}
-		case nil:
-			matched = append(matched, false)
-		default:
-			matched = append(matched, true)
-		}
+		overlay[name] = raw
+		env[name] = value
 
-		// Write everything before this match
-		result.WriteString(out[lastIndex:fullStart])
-		// Now the match
-		result.WriteString(fmt.Sprint(value))
-
-		lastIndex = fullEnd
+		return nil
 	}
 
-	// Append any remainder after last match
-	result.WriteString(out[lastIndex:])
-
-	return result.String(), slices.Contains(matched, true), nil
+	return env, add, nil
 }
 
-func exprParse(query string, facts map[string]any) (any, error) {
-	env, err := genExprEnv(facts)
-	if err != nil {
-		return "", err
+// lookupOverlay finds key in facts added to an expression environment, found is false when no fact was added for the
+// first segment of key
+func lookupOverlay(overlay map[string][]byte, key string) (gjson.Result, bool) {
+	if len(overlay) == 0 {
+		return gjson.Result{}, false
 	}
 
-	program, err := expr.Compile(query, expr.Env(env))
-	if err != nil {
-		return "", fmt.Errorf("expr compile error for '%s': %w", query, err)
+	segments := splitPath(key)
+	raw, ok := overlay[segments[0]]
+	switch {
+	case !ok:
+		return gjson.Result{}, false
+	case len(segments) == 1:
+		return gjson.ParseBytes(raw), true
+	default:
+		return gjson.GetBytes(raw, tracePath(segments[1:])), true
 	}
-
-	return expr.Run(program, env)
 }
 
-func expandMapExprValues(value map[string]any, facts map[string]any) (map[string]any, error) {
-	for k, v := range value {
-		nv, err := expandExprValuesRecursively(v, facts)
-		if err != nil {
-			return nil, err
-		}
-		value[k] = nv
+// applyFactsString parses {{ expression}} placeholders using expr and replace them with the resulting values
+func applyFactsString(template string, facts map[string]any) (string, bool, error) {
+	t, err := compileTemplate(template)
+	if err != nil {
+		return "", false, err
 	}
 
-	return value, nil
+	env, err := genExprEnv(facts, false)
+	if err != nil {
+		return "", false, err
+	}
+
+	return t.evalString(env)
 }
 
 // expandExprValuesRecursively walks a data structure and replaces {{ expression }} placeholders in all string values.
 // Maps and slices are recursively processed, while other types are returned unchanged.
 func expandExprValuesRecursively(value any, facts map[string]any) (any, error) {
-	switch typed := value.(type) {
-	case string:
-		// Apply expr template expansion to string values
-		return applyFactsTyped(typed, facts)
-	case map[string]any:
-		// Recursively process all map values
-		result := make(map[string]any, len(typed))
-		for key, val := range typed {
-			expanded, err := expandExprValuesRecursively(val, facts)
-			if err != nil {
-				return nil, err
-			}
-			result[key] = expanded
-		}
-		return result, nil
-	case []any:
-		// Recursively process all slice elements
-		result := make([]any, len(typed))
-		for i, val := range typed {
-			expanded, err := expandExprValuesRecursively(val, facts)
-			if err != nil {
-				return nil, err
-			}
-			result[i] = expanded
-		}
-		return result, nil
-	default:
-		// Return non-string, non-container types unchanged (int, bool, float, etc.)
-		return typed, nil
+	compiled, err := compileValue(value)
+	if err != nil {
+		return nil, err
 	}
+
+	env, err := genExprEnv(facts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return evalValue(compiled, env)
 }
 
 // normalizeNumericValues walks a decoded YAML structure and converts numeric values into int when they safely fit the
@@ -397,44 +648,22 @@ func normalizeNumericValues(value any) any {
 			return int(typed)
 		}
 		return typed
+	case json.Number:
+		if i, err := typed.Int64(); err == nil {
+			return normalizeNumericValues(i)
+		}
+		if u, err := strconv.ParseUint(typed.String(), 10, 64); err == nil {
+			return normalizeNumericValues(u)
+		}
+		if f, err := typed.Float64(); err == nil {
+			return normalizeNumericValues(f)
+		}
+		return typed.String()
 	default:
 		return typed
 	}
 }
 
-// shallowMerge merges source keys into target without recursion.
-func shallowMerge(target, source map[string]any) map[string]any {
-	result := cloneMap(target)
-	for key, value := range source {
-		result[key] = cloneValue(value)
-	}
-	return result
-}
-
-// deepMerge merges source maps into target recursively. Map values are merged, slices are concatenated, and other values override.
-func deepMerge(target, source map[string]any) map[string]any {
-	result := cloneMap(target)
-	for key, value := range source {
-		if existing, ok := result[key]; ok {
-			switch existingTyped := existing.(type) {
-			case map[string]any:
-				if incomingMap, ok := value.(map[string]any); ok {
-					result[key] = deepMerge(existingTyped, incomingMap)
-					continue
-				}
-			case []any:
-				if incomingSlice, ok := value.([]any); ok {
-					combined := append(cloneSlice(existingTyped), incomingSlice...)
-					result[key] = combined
-					continue
-				}
-			}
-		}
-		result[key] = cloneValue(value)
-	}
-	return result
-}
-
 // cloneMap creates a shallow copy of the provided map with cloned values.
 func cloneMap(source map[string]any) map[string]any {
 	result := make(map[string]any, len(source))
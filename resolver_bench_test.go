@@ -0,0 +1,279 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/expr-lang/expr"
+	"github.com/goccy/go-yaml"
+)
+
+var benchDocument = []byte(`
+hierarchy:
+  order:
+    - env:{{ lookup('env') }}
+    - role:{{ lookup('role') | lower() }}
+    - host:{{ lookup('networking.fqdn') }}
+  merge: deep
+
+data:
+  log_level: INFO
+  packages:
+    - ca-certificates
+  web:
+    listen_port: "{{ lookup('port', 80) }}"
+    server_name: "{{ lookup('networking.fqdn') }}"
+    tls: false
+
+overrides:
+  env:prod:
+    log_level: WARN
+
+  role:web:
+    packages:
+      - nginx
+    web:
+      tls: true
+      cert: /etc/pki/{{ lookup('networking.fqdn') }}.pem
+
+  host:web01.example.net:
+    log_level: TRACE
+`)
+
+// benchDerivedFacts is a facts section for benchDocument along with data using the derived facts
+var benchDerivedFacts = []byte(`
+facts:
+  domain: "{{ lookup('networking.fqdn') | split('.') | last() }}"
+  tier: "{{ env == 'prod' ? 'production' : 'development' }}"
+  admin_port: "{{ lookup('port', 80) + 1000 }}"
+  cert: /etc/pki/{{ lookup('domain') }}/{{ tier }}.pem
+
+admin:
+  port: "{{ admin_port }}"
+  cert: "{{ cert }}"
+`)
+
+func benchFacts(i int) map[string]any {
+	return map[string]any{
+		"env":  "prod",
+		"role": "WEB",
+		"port": 443,
+		"networking": map[string]any{
+			"fqdn": fmt.Sprintf("web%02d.example.net", i%100),
+		},
+	}
+}
+
+func benchRoot(b *testing.B) map[string]any {
+	root := map[string]any{}
+	err := yaml.Unmarshal(benchDocument, &root)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return root
+}
+
+// BenchmarkResolve measures the package level Resolve that compiles the document on every call
+func BenchmarkResolve(b *testing.B) {
+	root := benchRoot(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := Resolve(root, benchFacts(i), DefaultOptions, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkResolveUncompiled measures the resolve path used before documents were compiled, see uncompiledResolve
+func BenchmarkResolveUncompiled(b *testing.B) {
+	root := benchRoot(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := uncompiledResolve(root, benchFacts(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkResolverResolve measures resolving a document compiled once using New
+func BenchmarkResolverResolve(b *testing.B) {
+	resolver, err := New(benchRoot(b), DefaultOptions)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := resolver.Resolve(context.Background(), benchFacts(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkResolverResolveDerived measures resolving a document with derived facts compiled once using New
+func BenchmarkResolverResolveDerived(b *testing.B) {
+	derived := map[string]any{}
+	err := yaml.Unmarshal(benchDerivedFacts, &derived)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	root := benchRoot(b)
+	root["facts"] = derived["facts"]
+	root["data"].(map[string]any)["admin"] = derived["admin"]
+
+	resolver, err := New(root, DefaultOptions)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := resolver.Resolve(context.Background(), benchFacts(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkResolverResolveParallel measures concurrent use of a single compiled document
+func BenchmarkResolverResolveParallel(b *testing.B) {
+	resolver, err := New(benchRoot(b), DefaultOptions)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, err := resolver.Resolve(context.Background(), benchFacts(i))
+			if err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+// uncompiledResolve deep merges the document like releases before New did, every placeholder compiles its regular
+// expression and expression against a newly marshalled fact environment each time it is evaluated
+func uncompiledResolve(root map[string]any, facts map[string]any) (map[string]any, error) {
+	hierarchy, err := parseHierarchy(root)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := uncompiledExpand(root["data"], facts)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, _ := root["overrides"].(map[string]any)
+	merger := newMerger(nil, "", "")
+
+	for _, entry := range hierarchy.Order {
+		key, err := uncompiledString(entry.Name, facts)
+		if err != nil {
+			return nil, err
+		}
+
+		candidate, ok := overrides[key].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		expanded, err := uncompiledExpand(candidate, facts)
+		if err != nil {
+			return nil, err
+		}
+
+		base = merger.deepMerge(base.(map[string]any), expanded.(map[string]any))
+	}
+
+	return base.(map[string]any), nil
+}
+
+func uncompiledExpand(value any, facts map[string]any) (any, error) {
+	switch typed := value.(type) {
+	case string:
+		trimmed := strings.TrimSpace(typed)
+		matches := regexp.MustCompile(`{{\s*(.*?)\s*}}`).FindAllStringSubmatch(typed, -1)
+		if len(matches) == 1 && strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") {
+			return uncompiledExpr(matches[0][1], facts)
+		}
+		return uncompiledString(typed, facts)
+	case map[string]any:
+		result := make(map[string]any, len(typed))
+		for key, val := range typed {
+			expanded, err := uncompiledExpand(val, facts)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = expanded
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(typed))
+		for i, val := range typed {
+			expanded, err := uncompiledExpand(val, facts)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = expanded
+		}
+		return result, nil
+	default:
+		return typed, nil
+	}
+}
+
+func uncompiledString(source string, facts map[string]any) (string, error) {
+	re := regexp.MustCompile(`{{\s*(.*?)\s*}}`)
+
+	var err error
+	result := re.ReplaceAllStringFunc(source, func(match string) string {
+		var value any
+		value, err = uncompiledExpr(re.FindStringSubmatch(match)[1], facts)
+		return fmt.Sprint(value)
+	})
+
+	return result, err
+}
+
+func uncompiledExpr(query string, facts map[string]any) (any, error) {
+	env, err := genExprEnv(facts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := expr.Compile(query, expr.Env(env))
+	if err != nil {
+		return nil, err
+	}
+
+	return expr.Run(program, env)
+}
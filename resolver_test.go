@@ -5,6 +5,10 @@
 package tinyhiera
 
 import (
+	"context"
+	"fmt"
+	"sync"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -220,6 +224,250 @@ var _ = Describe("Resolve", func() {
 	})
 })
 
+var _ = Describe("Resolver", func() {
+	doc := []byte(`
+hierarchy:
+  order:
+    - env:{{ lookup('env') }}
+    - role:{{ lookup('role') }}
+  merge: deep
+
+data:
+  log_level: INFO
+  port: "{{ lookup('port', 80) }}"
+  packages:
+    - ca-certificates
+
+overrides:
+  env:prod:
+    log_level: WARN
+
+  role:web:
+    packages:
+      - nginx
+`)
+
+	It("Should resolve a compiled document against different facts", func() {
+		resolver, err := NewYaml(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := resolver.Resolve(context.Background(), map[string]any{"env": "prod", "role": "web", "port": 443})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(map[string]any{
+			"log_level": "WARN",
+			"port":      int64(443),
+			"packages":  []any{"ca-certificates", "nginx"},
+		}))
+
+		result, err = resolver.Resolve(context.Background(), map[string]any{"env": "dev"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(map[string]any{
+			"log_level": "INFO",
+			"port":      80,
+			"packages":  []any{"ca-certificates"},
+		}))
+	})
+
+	It("Should not share state between resolves", func() {
+		resolver, err := NewYaml(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := resolver.Resolve(context.Background(), map[string]any{"role": "web"})
+		Expect(err).NotTo(HaveOccurred())
+		result["packages"].([]any)[0] = "changed"
+
+		result, err = resolver.Resolve(context.Background(), map[string]any{"role": "web"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["packages"]).To(Equal([]any{"ca-certificates", "nginx"}))
+	})
+
+	It("Should be safe for concurrent use", func() {
+		resolver, err := NewYaml(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				result, err := resolver.Resolve(context.Background(), map[string]any{"env": "prod", "port": i})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result["port"]).To(Equal(int64(i)))
+				Expect(result["log_level"]).To(Equal("WARN"))
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	It("Should report compile errors when created", func() {
+		_, err := New(map[string]any{
+			"hierarchy": map[string]any{"order": []any{"env:{{ lookup('env' }}"}},
+		}, DefaultOptions)
+		Expect(err).To(MatchError(ContainSubstring("expr compile error for 'lookup('env''")))
+
+		_, err = New(map[string]any{
+			"hierarchy": map[string]any{"order": []any{"default"}},
+			"overrides": map[string]any{
+				"default": map[string]any{"value": "{{ 1 + }}"},
+			},
+		}, DefaultOptions)
+		Expect(err).To(MatchError(ContainSubstring("override default: expr compile error")))
+
+		_, err = New(map[string]any{
+			"hierarchy": map[string]any{"order": []any{"default"}, "merge": "other"},
+		}, DefaultOptions)
+		Expect(err).To(MatchError("unsupported merge mode: other"))
+	})
+
+	It("Should only apply conditional entries when their condition holds", func() {
+		resolver, err := NewYaml([]byte(`
+hierarchy:
+  order:
+    - name: large_prod
+      when: lookup('memory.total_bytes') > 8e9 && lookup('env') == 'prod'
+    - name: "role:{{ lookup('role') }}"
+      when: lookup('role') != ""
+  merge: deep
+
+data:
+  workers: 2
+  role: none
+
+overrides:
+  large_prod:
+    workers: 16
+  role:web:
+    role: web
+`), DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := resolver.Resolve(context.Background(), map[string]any{"env": "prod", "memory": map[string]any{"total_bytes": 16000000000}, "role": "web"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(map[string]any{"workers": 16, "role": "web"}))
+
+		result, err = resolver.Resolve(context.Background(), map[string]any{"env": "prod", "memory": map[string]any{"total_bytes": 4000000000}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(map[string]any{"workers": 2, "role": "none"}))
+	})
+
+	It("Should report invalid conditions", func() {
+		_, err := New(map[string]any{
+			"hierarchy": map[string]any{"order": []any{map[string]any{"name": "x", "when": "lookup('env') == "}}},
+		}, DefaultOptions)
+		Expect(err).To(MatchError(HavePrefix(`hierarchy order entry "x" when: expr compile error for 'lookup('env') == '`)))
+
+		_, err = New(map[string]any{
+			"hierarchy": map[string]any{"order": []any{map[string]any{"name": "x", "when": "data('y') == 1"}}},
+		}, DefaultOptions)
+		Expect(err).To(MatchError(`hierarchy order entry "x" when: can not use data()`))
+
+		resolver, err := New(map[string]any{
+			"hierarchy": map[string]any{"order": []any{map[string]any{"name": "x", "when": "lookup('env')"}}},
+		}, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = resolver.Resolve(context.Background(), map[string]any{"env": "prod"})
+		Expect(err).To(MatchError(`hierarchy order entry "x" when: expected a boolean but got string`))
+	})
+
+	It("Should fail on undefined variables like uncompiled documents did", func() {
+		resolver, err := NewYaml([]byte(`
+hierarchy:
+  order:
+    - env:{{ env }}
+data:
+  name: "{{ name ?? 'default' }}"
+`), DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = resolver.Resolve(context.Background(), map[string]any{})
+		Expect(err).To(MatchError("expr compile error for 'env': unknown name env"))
+
+		res, err := resolver.Resolve(context.Background(), map[string]any{"env": "prod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"name": "default"}))
+
+		_, err = Resolve(map[string]any{"data": map[string]any{"x": "{{ foo }}"}}, map[string]any{}, DefaultOptions, nil)
+		Expect(err).To(MatchError("expr compile error for 'foo': unknown name foo"))
+	})
+
+	It("Should honor context cancellation", func() {
+		resolver, err := NewYaml(doc, DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = resolver.Resolve(ctx, map[string]any{})
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
+
+var _ = Describe("List facts in the hierarchy", func() {
+	doc := []byte(`
+hierarchy:
+  order:
+    - role:{{ lookup('roles') }}
+  merge: %s
+
+data:
+  packages: []
+
+overrides:
+  role:web:
+    packages:
+      - nginx
+    port: 80
+
+  role:db:
+    packages:
+      - postgresql
+    port: 5432
+`)
+
+	resolve := func(mode string, facts map[string]any) map[string]any {
+		resolver, err := NewYaml([]byte(fmt.Sprintf(string(doc), mode)), DefaultOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := resolver.Resolve(context.Background(), facts)
+		Expect(err).NotTo(HaveOccurred())
+
+		return res
+	}
+
+	It("Should apply every element in order when deep merging", func() {
+		Expect(resolve("deep", map[string]any{"roles": []any{"web", "db"}})).To(Equal(map[string]any{
+			"packages": []any{"nginx", "postgresql"},
+			"port":     5432,
+		}))
+	})
+
+	It("Should apply the first matching element in first mode", func() {
+		Expect(resolve("first", map[string]any{"roles": []any{"mail", "db", "web"}})).To(Equal(map[string]any{
+			"packages": []any{"postgresql"},
+			"port":     5432,
+		}))
+	})
+
+	It("Should skip empty lists", func() {
+		Expect(resolve("deep", map[string]any{"roles": []any{}})).To(Equal(map[string]any{"packages": []any{}}))
+	})
+
+	It("Should expand every combination of many lists", func() {
+		t, err := compileTemplate("{{ envs }}-{{ roles }}-{{ site }}")
+		Expect(err).NotTo(HaveOccurred())
+
+		keys, err := t.evalCandidates(map[string]any{"envs": []string{"dev", "prod"}, "roles": []any{"web", ""}, "site": "lon"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(Equal([]string{"dev-web-lon", "dev--lon", "prod-web-lon", "prod--lon"}))
+
+		keys, err = t.evalCandidates(map[string]any{"envs": []any{}, "roles": []any{"web"}, "site": "lon"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(BeEmpty())
+	})
+})
+
 var _ = Describe("parseHierarchy", func() {
 	It("extracts order and merge data", func() {
 		// Ensures hierarchy parsing returns expected values when the structure is correct.
@@ -232,10 +480,35 @@ var _ = Describe("parseHierarchy", func() {
 
 		hierarchy, err := parseHierarchy(root)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(hierarchy.Order).To(Equal([]string{"global", "env:%{env}"}))
+		Expect(hierarchy.Order).To(Equal([]OrderEntry{{Name: "global"}, {Name: "env:%{env}"}}))
 		Expect(hierarchy.Merge).To(Equal("deep"))
 	})
 
+	It("extracts conditional order entries", func() {
+		root := map[string]any{
+			"hierarchy": map[string]any{
+				"order": []any{"global", map[string]any{"name": "large_prod", "when": "env == 'prod'"}},
+			},
+		}
+
+		hierarchy, err := parseHierarchy(root)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hierarchy.Order).To(Equal([]OrderEntry{{Name: "global"}, {Name: "large_prod", When: "env == 'prod'"}}))
+
+		for entry, msg := range map[string]string{
+			"name": `hierarchy.order.0: name must be a string`,
+			"when": `hierarchy.order.0: name is required`,
+			"if":   `hierarchy.order.0: unknown key "if"`,
+		} {
+			value := map[string]any{entry: 1}
+			if entry == "when" {
+				value[entry] = "true"
+			}
+			_, err = parseHierarchy(map[string]any{"hierarchy": map[string]any{"order": []any{value}}})
+			Expect(err).To(MatchError(msg))
+		}
+	})
+
 	It("returns an error when the hierarchy is malformed", func() {
 		// Validates that bad hierarchy data is rejected early.
 		root := map[string]any{
@@ -245,7 +518,7 @@ var _ = Describe("parseHierarchy", func() {
 		}
 
 		_, err := parseHierarchy(root)
-		Expect(err).To(MatchError("hierarchy.order must contain only strings"))
+		Expect(err).To(MatchError("hierarchy.order must contain only strings or maps with a name and when"))
 	})
 })
 
@@ -468,7 +741,7 @@ var _ = Describe("clone helpers", func() {
 			"list": []any{2},
 		}
 
-		merged := deepMerge(target, source)
+		merged := newMerger(nil, "", "").deepMerge(target, source)
 		merged["list"].([]any)[0] = 42
 
 		Expect(target["list"].([]any)).To(Equal([]any{1}))
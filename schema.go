@@ -0,0 +1,470 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaViolation is a single way in which resolved data does not match the schema
+type SchemaViolation struct {
+	// Path is the gjson path to the offending value, empty for the root of the data
+	Path string `json:"path"`
+	// Message describes the violation
+	Message string `json:"message"`
+	// Layers lists the data key or override keys that supplied the offending value
+	Layers []string `json:"layers,omitempty"`
+
+	// missing indicates the violation is about a value that does not exist so no layer supplied it
+	missing bool
+}
+
+func (v SchemaViolation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "data"
+	}
+
+	if len(v.Layers) == 0 {
+		return fmt.Sprintf("%s: %s", path, v.Message)
+	}
+
+	return fmt.Sprintf("%s: %s (set by %s)", path, v.Message, strings.Join(v.Layers, ", "))
+}
+
+// SchemaError is returned when resolved data does not match the schema
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = v.String()
+	}
+
+	return fmt.Sprintf("resolved data failed schema validation: %s", strings.Join(lines, ", "))
+}
+
+// schema is a compiled subset of JSON Schema
+type schema struct {
+	types            []string
+	properties       map[string]*schema
+	required         []string
+	additional       *schema
+	noAdditional     bool
+	items            *schema
+	enum             []any
+	constValue       any
+	hasConst         bool
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	minLength        *int
+	maxLength        *int
+	pattern          *regexp.Regexp
+	minItems         *int
+	maxItems         *int
+	uniqueItems      bool
+	allOf            []*schema
+	anyOf            []*schema
+	oneOf            []*schema
+	not              *schema
+}
+
+var schemaTypes = []string{"object", "array", "string", "integer", "number", "boolean", "null"}
+
+// schemaKeywords are the JSON Schema keywords that are validated
+var schemaKeywords = []string{
+	"type", "properties", "required", "additionalProperties", "items", "enum", "const", "minimum", "maximum",
+	"exclusiveMinimum", "exclusiveMaximum", "minLength", "maxLength", "pattern", "minItems", "maxItems", "uniqueItems",
+	"allOf", "anyOf", "oneOf", "not",
+}
+
+// schemaAnnotations are JSON Schema keywords that do not affect validation
+var schemaAnnotations = []string{
+	"$schema", "$id", "$comment", "title", "description", "default", "examples", "deprecated", "readOnly", "writeOnly",
+}
+
+// compileSchema compiles a JSON Schema document, only schemaKeywords and schemaAnnotations are supported and any other
+// keyword is an error so schemas are never silently weaker than they look
+func compileSchema(raw any) (*schema, error) {
+	return compileSchemaAt(raw, "schema")
+}
+
+func compileSchemaAt(raw any, at string) (*schema, error) {
+	if b, ok := raw.(bool); ok {
+		if b {
+			return &schema{}, nil
+		}
+		return &schema{not: &schema{}}, nil
+	}
+
+	def, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map", at)
+	}
+
+	for _, key := range sortedKeys(def) {
+		if !slices.Contains(schemaKeywords, key) && !slices.Contains(schemaAnnotations, key) {
+			return nil, fmt.Errorf("%s: %s is not supported", at, key)
+		}
+	}
+
+	s := &schema{}
+	var err error
+
+	switch typed := def["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{typed}
+	case []any:
+		for _, t := range typed {
+			ts, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s.type must be a string or list of strings", at)
+			}
+			s.types = append(s.types, ts)
+		}
+	default:
+		return nil, fmt.Errorf("%s.type must be a string or list of strings", at)
+	}
+	for _, t := range s.types {
+		if !slices.Contains(schemaTypes, t) {
+			return nil, fmt.Errorf("%s.type: unknown type %q", at, t)
+		}
+	}
+
+	if props, ok := def["properties"]; ok {
+		pm, ok := props.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s.properties must be a map", at)
+		}
+
+		s.properties = make(map[string]*schema, len(pm))
+		for key, val := range pm {
+			s.properties[key], err = compileSchemaAt(val, fmt.Sprintf("%s.properties.%s", at, key))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if req, ok := def["required"]; ok {
+		list, ok := req.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s.required must be a list", at)
+		}
+		for _, r := range list {
+			rs, ok := r.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s.required must be a list of strings", at)
+			}
+			s.required = append(s.required, rs)
+		}
+	}
+
+	switch typed := def["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		s.noAdditional = !typed
+	default:
+		s.additional, err = compileSchemaAt(typed, at+".additionalProperties")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if items, ok := def["items"]; ok {
+		s.items, err = compileSchemaAt(items, at+".items")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if enum, ok := def["enum"]; ok {
+		s.enum, ok = enum.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s.enum must be a list", at)
+		}
+	}
+
+	s.constValue, s.hasConst = def["const"]
+
+	for key, target := range map[string]**float64{
+		"minimum":          &s.minimum,
+		"maximum":          &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMinimum,
+		"exclusiveMaximum": &s.exclusiveMaximum,
+	} {
+		if val, ok := def[key]; ok {
+			f, ok := toFloat64(val)
+			if !ok {
+				return nil, fmt.Errorf("%s.%s must be a number", at, key)
+			}
+			*target = &f
+		}
+	}
+
+	for key, target := range map[string]**int{
+		"minLength": &s.minLength,
+		"maxLength": &s.maxLength,
+		"minItems":  &s.minItems,
+		"maxItems":  &s.maxItems,
+	} {
+		if val, ok := def[key]; ok {
+			i, ok := toInt64(val)
+			if !ok || i < 0 {
+				return nil, fmt.Errorf("%s.%s must be a positive integer", at, key)
+			}
+			n := int(i)
+			*target = &n
+		}
+	}
+
+	if pattern, ok := def["pattern"]; ok {
+		ps, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s.pattern must be a string", at)
+		}
+		s.pattern, err = regexp.Compile(ps)
+		if err != nil {
+			return nil, fmt.Errorf("%s.pattern: %w", at, err)
+		}
+	}
+
+	s.uniqueItems, _ = def["uniqueItems"].(bool)
+
+	for key, target := range map[string]*[]*schema{
+		"allOf": &s.allOf,
+		"anyOf": &s.anyOf,
+		"oneOf": &s.oneOf,
+	} {
+		if val, ok := def[key]; ok {
+			list, ok := val.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s.%s must be a list", at, key)
+			}
+			for i, item := range list {
+				compiled, err := compileSchemaAt(item, fmt.Sprintf("%s.%s.%d", at, key, i))
+				if err != nil {
+					return nil, err
+				}
+				*target = append(*target, compiled)
+			}
+		}
+	}
+
+	if not, ok := def["not"]; ok {
+		s.not, err = compileSchemaAt(not, at+".not")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// validate checks value against the schema and returns all violations
+func (s *schema) validate(path []string, value any) []SchemaViolation {
+	var violations []SchemaViolation
+
+	fail := func(format string, args ...any) {
+		violations = append(violations, SchemaViolation{Path: tracePath(path), Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return schemaTypeMatches(t, value) }) {
+		fail("expected %s but got %s", strings.Join(s.types, " or "), schemaTypeOf(value))
+		return violations
+	}
+
+	if s.hasConst && !valuesEqual(s.constValue, value) {
+		fail("must be %v", s.constValue)
+	}
+
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return valuesEqual(e, value) }) {
+		fail("must be one of %v", s.enum)
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		for _, key := range s.required {
+			if _, ok := typed[key]; !ok {
+				violations = append(violations, SchemaViolation{Path: tracePath(path), Message: fmt.Sprintf("missing required key %q", key), missing: true})
+			}
+		}
+
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			keyPath := append(slices.Clone(path), key)
+
+			if prop, ok := s.properties[key]; ok {
+				violations = append(violations, prop.validate(keyPath, typed[key])...)
+				continue
+			}
+
+			switch {
+			case s.noAdditional:
+				violations = append(violations, SchemaViolation{Path: tracePath(keyPath), Message: "key is not allowed"})
+			case s.additional != nil:
+				violations = append(violations, s.additional.validate(keyPath, typed[key])...)
+			}
+		}
+
+	case []any:
+		if s.minItems != nil && len(typed) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(typed) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.uniqueItems {
+			for i := range typed {
+				if slices.ContainsFunc(typed[:i], func(e any) bool { return valuesEqual(e, typed[i]) }) {
+					fail("items must be unique")
+					break
+				}
+			}
+		}
+		if s.items != nil {
+			for i, item := range typed {
+				violations = append(violations, s.items.validate(append(slices.Clone(path), fmt.Sprint(i)), item)...)
+			}
+		}
+
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if s.minLength != nil && length < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(typed) {
+			fail("must match pattern %s", s.pattern.String())
+		}
+
+	default:
+		if f, ok := toFloat64(value); ok {
+			if s.minimum != nil && f < *s.minimum {
+				fail("must be >= %v", *s.minimum)
+			}
+			if s.maximum != nil && f > *s.maximum {
+				fail("must be <= %v", *s.maximum)
+			}
+			if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+				fail("must be > %v", *s.exclusiveMinimum)
+			}
+			if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+				fail("must be < %v", *s.exclusiveMaximum)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		violations = append(violations, sub.validate(path, value)...)
+	}
+
+	if len(s.anyOf) > 0 && !slices.ContainsFunc(s.anyOf, func(sub *schema) bool { return len(sub.validate(path, value)) == 0 }) {
+		fail("must match at least one schema in anyOf")
+	}
+
+	if len(s.oneOf) > 0 {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if len(sub.validate(path, value)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("must match exactly one schema in oneOf but matched %d", matched)
+		}
+	}
+
+	if s.not != nil && len(s.not.validate(path, value)) == 0 {
+		fail("must not match the schema in not")
+	}
+
+	return violations
+}
+
+// attributeViolations sets the layers that supplied each violating value using trace entries
+func attributeViolations(violations []SchemaViolation, trace []TraceEntry) {
+	for i, v := range violations {
+		if v.missing {
+			continue
+		}
+
+		var layers []string
+		for _, entry := range trace {
+			if v.Path == "" || entry.Path == v.Path || strings.HasPrefix(entry.Path, v.Path+".") {
+				if !slices.Contains(layers, entry.Layer) {
+					layers = append(layers, entry.Layer)
+				}
+			}
+		}
+		violations[i].Layers = layers
+	}
+}
+
+func schemaTypeMatches(t string, value any) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "integer":
+		_, ok := toInt64(value)
+		return ok
+	case "number":
+		_, ok := toFloat64(value)
+		return ok
+	default:
+		return false
+	}
+}
+
+func schemaTypeOf(value any) string {
+	for _, t := range schemaTypes {
+		if schemaTypeMatches(t, value) {
+			return t
+		}
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+// valuesEqual compares values treating all numeric types with the same value as equal
+func valuesEqual(a any, b any) bool {
+	af, aok := toFloat64(a)
+	bf, bok := toFloat64(b)
+	if aok && bok {
+		return af == bf || (math.IsNaN(af) && math.IsNaN(bf))
+	}
+
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schema validation", func() {
+	doc := []byte(`
+hierarchy:
+  order:
+    - env:{{ lookup('env') }}
+    - role:{{ lookup('role') }}
+  merge: deep
+
+schema:
+  type: object
+  additionalProperties: false
+  required: [log_level, web]
+  properties:
+    log_level:
+      enum: [TRACE, DEBUG, INFO, WARN]
+    packages:
+      type: array
+      uniqueItems: true
+      items:
+        type: string
+        minLength: 1
+    web:
+      type: object
+      required: [listen_port]
+      properties:
+        listen_port:
+          type: integer
+          minimum: 1
+          maximum: 65535
+        server_name:
+          type: string
+          pattern: ^[a-z.]+$
+
+data:
+  log_level: INFO
+  packages:
+    - ca-certificates
+  web:
+    listen_port: "{{ lookup('port', 80) }}"
+
+overrides:
+  env:prod:
+    log_level: WARNING
+    web:
+      server_name: Example.COM
+
+  role:web:
+    pakages:
+      - nginx
+    packages:
+      - ca-certificates
+`)
+
+	It("Should pass valid data", func() {
+		res, err := ResolveYaml(doc, map[string]any{"port": 443}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res["web"]).To(Equal(map[string]any{"listen_port": int64(443)}))
+	})
+
+	It("Should report every violation with the layers that introduced it", func() {
+		_, err := ResolveYaml(doc, map[string]any{"env": "prod", "role": "web", "port": 70000}, DefaultOptions, nil)
+
+		var se *SchemaError
+		Expect(errors.As(err, &se)).To(BeTrue())
+		Expect(se.Violations).To(Equal([]SchemaViolation{
+			{Path: "log_level", Message: "must be one of [TRACE DEBUG INFO WARN]", Layers: []string{"env:prod"}},
+			{Path: "packages", Message: "items must be unique", Layers: []string{"data", "role:web"}},
+			{Path: "pakages", Message: "key is not allowed", Layers: []string{"role:web"}},
+			{Path: "web.listen_port", Message: "must be <= 65535", Layers: []string{"data"}},
+			{Path: "web.server_name", Message: "must match pattern ^[a-z.]+$", Layers: []string{"env:prod"}},
+		}))
+		Expect(err).To(MatchError(ContainSubstring("pakages: key is not allowed (set by role:web)")))
+	})
+
+	It("Should support a schema supplied in options", func() {
+		opts := DefaultOptions
+		opts.Schema = map[string]any{
+			"required": []any{"other"},
+			"properties": map[string]any{
+				"web": map[string]any{"type": "string"},
+			},
+		}
+
+		_, err := ResolveYaml(doc, map[string]any{}, opts, nil)
+		Expect(err).To(MatchError(`resolved data failed schema validation: data: missing required key "other", web: expected string but got object (set by data)`))
+	})
+
+	It("Should reject invalid schemas", func() {
+		_, err := New(map[string]any{"schema": map[string]any{"type": "thing"}}, DefaultOptions)
+		Expect(err).To(MatchError(`schema.type: unknown type "thing"`))
+
+		_, err = New(map[string]any{"schema": map[string]any{"properties": map[string]any{"x": map[string]any{"$ref": "#/y"}}}}, DefaultOptions)
+		Expect(err).To(MatchError("schema.properties.x: $ref is not supported"))
+
+		_, err = New(map[string]any{"schema": map[string]any{
+			"title":             "config",
+			"minProperties":     5,
+			"patternProperties": map[string]any{"^x": map[string]any{"type": "integer"}},
+		}}, DefaultOptions)
+		Expect(err).To(MatchError("schema: minProperties is not supported"))
+
+		for _, keyword := range []string{"propertyNames", "if", "dependentRequired", "format", "$defs"} {
+			_, err = compileSchema(map[string]any{"description": "x", keyword: map[string]any{}})
+			Expect(err).To(MatchError(fmt.Sprintf("schema: %s is not supported", keyword)))
+		}
+	})
+
+	It("Should validate combinators", func() {
+		s, err := compileSchema(map[string]any{
+			"anyOf": []any{map[string]any{"type": "string"}, map[string]any{"type": "integer"}},
+			"not":   map[string]any{"const": "bad"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(s.validate(nil, "ok")).To(BeEmpty())
+		Expect(s.validate(nil, 1)).To(BeEmpty())
+		Expect(s.validate(nil, true)).To(Equal([]SchemaViolation{{Message: "must match at least one schema in anyOf"}}))
+		Expect(s.validate(nil, "bad")).To(Equal([]SchemaViolation{{Message: "must not match the schema in not"}}))
+	})
+})
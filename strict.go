@@ -0,0 +1,219 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// strictEnvKey marks an expression environment as strict, it can not be referenced as a variable in expressions
+const strictEnvKey = "$strict"
+
+// UndefinedFactError is returned in strict mode when an expression uses a fact that does not exist without a default
+type UndefinedFactError struct {
+	// Fact is the missing fact
+	Fact string
+	// Expression is the expression using the fact
+	Expression string
+	// Path is the location of the expression in the document
+	Path string
+}
+
+func (e *UndefinedFactError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("undefined fact %q in expression '%s'", e.Fact, e.Expression)
+	}
+
+	return fmt.Sprintf("%s: undefined fact %q in expression '%s'", e.Path, e.Fact, e.Expression)
+}
+
+// isStrict determines if undefined facts are errors in env
+func isStrict(env map[string]any) bool {
+	strict, _ := env[strictEnvKey].(bool)
+	return strict
+}
+
+// runExpression runs a compiled expression, using a variable that is not in env is an error. In strict mode the
+// error is an UndefinedFactError, it is also returned when a member of a fact like networking.fqdn does not exist, and
+// undefined fact errors from lookup() are returned without the expr error wrapping them
+func runExpression(compiled *expression, env map[string]any) (any, error) {
+	strict := isStrict(env)
+
+	for _, path := range compiled.variables {
+		value, ok := env[path[0]]
+		switch {
+		case !ok && !strict:
+			return nil, fmt.Errorf("expr compile error for '%s': unknown name %s", compiled.source, path[0])
+		case strict && (!ok || !hasMember(value, path[1:])):
+			return nil, &UndefinedFactError{Fact: tracePath(path), Expression: compiled.source}
+		}
+	}
+
+	res, err := expr.Run(compiled.program, env)
+	if err != nil && strict {
+		var uerr *UndefinedFactError
+		if errors.As(err, &uerr) {
+			uerr.Expression = compiled.source
+			return nil, uerr
+		}
+	}
+
+	return res, err
+}
+
+// hasMember determines if value holds the nested keys or slice indexes in path, values that can not be walked like
+// structs are assumed to hold them
+func hasMember(value any, path []string) bool {
+	current := reflect.ValueOf(value)
+
+	for _, segment := range path {
+		for current.Kind() == reflect.Interface || current.Kind() == reflect.Pointer {
+			current = current.Elem()
+		}
+
+		switch current.Kind() {
+		case reflect.Map:
+			if current.Type().Key().Kind() != reflect.String {
+				return true
+			}
+			current = current.MapIndex(reflect.ValueOf(segment).Convert(current.Type().Key()))
+			if !current.IsValid() {
+				return false
+			}
+		case reflect.Slice, reflect.Array:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 {
+				return true
+			}
+			if idx >= current.Len() {
+				return false
+			}
+			current = current.Index(idx)
+		case reflect.Invalid:
+			return false
+		default:
+			return true
+		}
+	}
+
+	return true
+}
+
+// undefinedAt adds segments to the front of the path of an undefined fact error, other errors are returned unchanged
+func undefinedAt(err error, segments ...string) error {
+	var uerr *UndefinedFactError
+	if !errors.As(err, &uerr) {
+		return err
+	}
+
+	if uerr.Path == "" {
+		uerr.Path = tracePath(segments)
+	} else {
+		uerr.Path = tracePath(segments) + "." + uerr.Path
+	}
+
+	return err
+}
+
+// usedVariables lists the variables an expression requires along with the constant keys and indexes it accesses on
+// them, networking.fqdn is the path networking, fqdn. Function names, variables declared using let and variables on
+// the left of ?? are not required
+func usedVariables(program *vm.Program) [][]string {
+	node := program.Node()
+	v := &variableVisitor{optional: map[string]bool{}}
+	ast.Walk(&node, v)
+
+	return slices.DeleteFunc(v.paths, func(path []string) bool {
+		return v.optional[path[0]] || strings.HasPrefix(path[0], "$")
+	})
+}
+
+type variableVisitor struct {
+	paths    [][]string
+	optional map[string]bool
+}
+
+// add records path unless a longer path starting with it is known, shorter paths it starts with are replaced
+func (v *variableVisitor) add(path []string) {
+	for _, known := range v.paths {
+		if len(known) >= len(path) && slices.Equal(known[:len(path)], path) {
+			return
+		}
+	}
+
+	for i, known := range v.paths {
+		if len(known) < len(path) && slices.Equal(path[:len(known)], known) {
+			v.paths[i] = path
+			v.paths = slices.DeleteFunc(v.paths, func(other []string) bool {
+				return len(other) < len(path) && slices.Equal(path[:len(other)], other)
+			})
+			return
+		}
+	}
+
+	v.paths = append(v.paths, path)
+}
+
+func (v *variableVisitor) Visit(node *ast.Node) {
+	switch typed := (*node).(type) {
+	case *ast.IdentifierNode:
+		v.add([]string{typed.Value})
+	case *ast.MemberNode:
+		if path, _ := memberPath(typed); len(path) > 0 {
+			v.add(path)
+		}
+	case *ast.CallNode:
+		if ident, ok := typed.Callee.(*ast.IdentifierNode); ok {
+			v.optional[ident.Value] = true
+		}
+	case *ast.VariableDeclaratorNode:
+		v.optional[typed.Name] = true
+	case *ast.BinaryNode:
+		if typed.Operator != "??" {
+			return
+		}
+		left := &variableVisitor{optional: map[string]bool{}}
+		ast.Walk(&typed.Left, left)
+		for _, path := range left.paths {
+			v.optional[path[0]] = true
+		}
+	}
+}
+
+// memberPath finds the variable a member access starts at and the constant keys and indexes accessed on it, exact
+// is false once a property is computed, optional or a method so later properties are not part of the path
+func memberPath(node ast.Node) (path []string, exact bool) {
+	switch typed := node.(type) {
+	case *ast.IdentifierNode:
+		return []string{typed.Value}, true
+	case *ast.ChainNode:
+		return memberPath(typed.Node)
+	case *ast.MemberNode:
+		path, exact := memberPath(typed.Node)
+		if !exact || typed.Optional || typed.Method {
+			return path, false
+		}
+
+		switch property := typed.Property.(type) {
+		case *ast.StringNode:
+			return append(path, property.Value), true
+		case *ast.IntegerNode:
+			return append(path, strconv.Itoa(property.Value)), true
+		}
+
+		return path, false
+	}
+
+	return nil, false
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strict mode", func() {
+	doc := []byte(`
+facts:
+  site: "{{ lookup('location.site', 'lon') }}"
+
+hierarchy:
+  order:
+    - env:{{ lookup('environment') }}
+    - name: large
+      when: memory > 8
+  merge: deep
+
+data:
+  port: "{{ port ?? 80 }}"
+  site: "{{ site }}"
+
+overrides:
+  env:prod:
+    log_level: "{{ lookup('log.level') }}"
+    workers:
+      - "{{ let n = cpus; n * 2 }}"
+`)
+
+	resolve := func(strict bool, facts map[string]any) (map[string]any, error) {
+		opts := DefaultOptions
+		opts.Strict = strict
+
+		resolver, err := NewYaml(doc, opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		return resolver.Resolve(context.Background(), facts)
+	}
+
+	It("Should ignore undefined facts when not strict", func() {
+		res, err := resolve(false, map[string]any{"memory": 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"port": 80, "site": "lon"}))
+	})
+
+	It("Should resolve when all facts are defined", func() {
+		res, err := resolve(true, map[string]any{"environment": "prod", "memory": 4, "cpus": 2, "log": map[string]any{"level": "warn"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"port": 80, "site": "lon", "log_level": "warn", "workers": []any{4}}))
+	})
+
+	It("Should report undefined facts used with lookup", func() {
+		_, err := resolve(true, map[string]any{"memory": 4})
+		Expect(err).To(MatchError(`hierarchy.order.0: undefined fact "environment" in expression 'lookup('environment')'`))
+
+		_, err = resolve(true, map[string]any{"environment": "prod", "memory": 4, "cpus": 2})
+		Expect(err).To(MatchError(`overrides.env:prod.log_level: undefined fact "log.level" in expression 'lookup('log.level')'`))
+	})
+
+	It("Should report undefined variables", func() {
+		_, err := resolve(true, map[string]any{"environment": "dev"})
+		Expect(err).To(MatchError(`hierarchy.order.1.when: undefined fact "memory" in expression 'memory > 8'`))
+
+		_, err = resolve(true, map[string]any{"environment": "prod", "memory": 4, "log": map[string]any{"level": "warn"}})
+		uerr, ok := err.(*UndefinedFactError)
+		Expect(ok).To(BeTrue())
+		Expect(uerr.Fact).To(Equal("cpus"))
+		Expect(uerr.Expression).To(Equal("let n = cpus; n * 2"))
+		Expect(uerr.Path).To(Equal("overrides.env:prod.workers.0"))
+	})
+
+	It("Should report undefined facts in derived facts", func() {
+		r, err := New(map[string]any{
+			"facts":     map[string]any{"dc": "{{ lookup('networking.domain') }}"},
+			"hierarchy": map[string]any{"order": []any{"default"}},
+		}, Options{DataKey: "data", Strict: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.Resolve(context.Background(), map[string]any{})
+		Expect(err).To(MatchError(`facts.dc: undefined fact "networking.domain" in expression 'lookup('networking.domain')'`))
+	})
+
+	It("Should report undefined members of facts", func() {
+		r, err := NewYaml([]byte(`
+hierarchy:
+  order:
+    - host:{{ networking.fqdn }}
+    - name: "{{ networking['interfaces'][1] }}"
+      when: networking?.missing == nil
+data:
+  port: "{{ ports[0] + (tls?.port ?? 0) }}"
+`), Options{DataKey: "data", Strict: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.Resolve(context.Background(), map[string]any{"networking": map[string]any{"hostname": "x"}, "ports": []any{80}})
+		Expect(err).To(MatchError(`hierarchy.order.0: undefined fact "networking.fqdn" in expression 'networking.fqdn'`))
+
+		_, err = r.Resolve(context.Background(), map[string]any{"networking": map[string]any{"fqdn": "x", "interfaces": []any{"eth0"}}, "ports": []any{80}})
+		Expect(err).To(MatchError(`hierarchy.order.1: undefined fact "networking.interfaces.1" in expression 'networking['interfaces'][1]'`))
+
+		_, err = r.Resolve(context.Background(), map[string]any{"networking": map[string]any{"fqdn": "x", "interfaces": []string{"eth0", "eth1"}}, "ports": []any{}})
+		Expect(err).To(MatchError(`data.port: undefined fact "ports.0" in expression 'ports[0] + (tls?.port ?? 0)'`))
+
+		res, err := r.Resolve(context.Background(), map[string]any{"networking": map[string]any{"fqdn": "x", "interfaces": []string{"eth0", "eth1"}}, "ports": []any{80}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"port": 80}))
+
+		r.opts.Strict = false
+		res, err = r.Resolve(context.Background(), map[string]any{"networking": map[string]any{"hostname": "x", "interfaces": []string{"eth0", "eth1"}}, "ports": []any{80}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(map[string]any{"port": 80}))
+	})
+
+	It("Should only require variables that have no default", func() {
+		for expression, expected := range map[string][][]string{
+			"a + b":                       {{"a"}, {"b"}},
+			"lookup('x') + c":             {{"c"}},
+			"(a.b ?? c) + d":              {{"c"}, {"d"}},
+			"let x = 1; x + y":            {{"y"}},
+			"filter(a, # > limit)":        {{"a"}, {"limit"}},
+			"$env['x'] ?? 'default'":      {},
+			"a.b.c + a.b + len(a)":        {{"a", "b", "c"}},
+			"a['x'][0] + b[c].d":          {{"a", "x", "0"}, {"b"}, {"c"}},
+			"a?.b.c + len(filter(l, .x))": {{"a"}, {"l"}},
+		} {
+			compiled, err := compileExpression(expression)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(compiled.variables).To(Equal(expected), expression)
+		}
+	})
+})
@@ -0,0 +1,373 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// placeholderRe matches {{ something }} with capture group 1 being the inner expression
+var placeholderRe = regexp.MustCompile(`{{\s*(.*?)\s*}}`)
+
+// compileEnv is the environment used to type check expressions at compile time, the real environment is created per resolve
+var compileEnv = map[string]any{
+	"lookup": func(string, ...any) (any, error) { return nil, nil },
+	"data":   func(string, ...any) (any, error) { return nil, nil },
+}
+
+// template is a string that was parsed once for {{ expression }} placeholders with every expression compiled
+type template struct {
+	// source is the original string
+	source string
+	// literals holds the text surrounding placeholders, it always has one more entry than programs
+	literals []string
+	// expressions holds the compiled placeholder expressions
+	expressions []*expression
+	// typed indicates the entire string is a single placeholder and evaluation should return the expression result unchanged
+	typed bool
+	// refsData indicates an expression calls data() so the template can only be evaluated once all layers are merged
+	refsData bool
+	// captures are the capture groups of the override pattern that selected the layer holding a template calling data(),
+	// they are kept with the template as it is evaluated once all layers are merged
+	captures []any
+}
+
+// compileTemplate parses a string for placeholders and compiles each expression
+func compileTemplate(source string) (*template, error) {
+	t := &template{source: source}
+
+	matches := placeholderRe.FindAllStringSubmatchIndex(source, -1)
+	if matches == nil {
+		t.literals = []string{source}
+		return t, nil
+	}
+
+	trimmed := strings.TrimSpace(source)
+	t.typed = len(matches) == 1 && strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}")
+
+	lastIndex := 0
+	for _, loc := range matches {
+		fullStart, fullEnd := loc[0], loc[1]
+		innerExpr := source[loc[2]:loc[3]]
+
+		compiled, err := compileExpression(innerExpr)
+		if err != nil {
+			return nil, err
+		}
+
+		t.literals = append(t.literals, source[lastIndex:fullStart])
+		t.expressions = append(t.expressions, compiled)
+		t.refsData = t.refsData || callsFunction(compiled.program, "data")
+
+		lastIndex = fullEnd
+	}
+	t.literals = append(t.literals, source[lastIndex:])
+
+	return t, nil
+}
+
+// expression is a compiled expr expression
+type expression struct {
+	// source is the original expression
+	source string
+	// program is the compiled expression
+	program *vm.Program
+	// variables are the paths of the variables the expression requires, see usedVariables
+	variables [][]string
+}
+
+// compileExpression compiles a single expr expression against the generic compile environment, variables are only
+// known once facts are supplied so they are checked when the expression runs
+func compileExpression(query string, opts ...expr.Option) (*expression, error) {
+	opts = append([]expr.Option{expr.Env(compileEnv), expr.AllowUndefinedVariables()}, opts...)
+
+	program, err := expr.Compile(query, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("expr compile error for '%s': %w", query, err)
+	}
+
+	return &expression{source: query, program: program, variables: usedVariables(program)}, nil
+}
+
+// orderEntry is a compiled hierarchy order entry
+type orderEntry struct {
+	// name is the template producing the override key
+	name *template
+	// when is the condition for the entry to apply, nil when it always applies
+	when *expression
+}
+
+// compileOrderEntry compiles the name and condition of a hierarchy order entry
+func compileOrderEntry(entry OrderEntry) (*orderEntry, error) {
+	name, err := compileTemplate(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	if name.refsData {
+		return nil, fmt.Errorf("hierarchy order entry %q can not use data()", entry.Name)
+	}
+
+	compiled := &orderEntry{name: name}
+	if entry.When == "" {
+		return compiled, nil
+	}
+
+	compiled.when, err = compileExpression(entry.When, expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("hierarchy order entry %q when: %w", entry.Name, err)
+	}
+	if callsFunction(compiled.when.program, "data") {
+		return nil, fmt.Errorf("hierarchy order entry %q when: can not use data()", entry.Name)
+	}
+
+	return compiled, nil
+}
+
+// applies evaluates the condition of the entry
+func (e *orderEntry) applies(env map[string]any) (bool, error) {
+	if e.when == nil {
+		return true, nil
+	}
+
+	res, err := runExpression(e.when, env)
+	switch {
+	case errors.As(err, new(*UndefinedFactError)):
+		return false, undefinedAt(err, "when")
+	case err != nil:
+		return false, fmt.Errorf("hierarchy order entry %q when: %w", e.name.source, err)
+	}
+
+	applies, ok := res.(bool)
+	if !ok {
+		return false, fmt.Errorf("hierarchy order entry %q when: expected a boolean but got %T", e.name.source, res)
+	}
+
+	return applies, nil
+}
+
+// callsFunction determines if a compiled expression calls the named function
+func callsFunction(program *vm.Program, name string) bool {
+	node := program.Node()
+	v := &callVisitor{name: name}
+	ast.Walk(&node, v)
+
+	return v.found
+}
+
+type callVisitor struct {
+	name  string
+	found bool
+}
+
+func (v *callVisitor) Visit(node *ast.Node) {
+	call, ok := (*node).(*ast.CallNode)
+	if !ok {
+		return
+	}
+
+	if ident, ok := call.Callee.(*ast.IdentifierNode); ok && ident.Value == v.name {
+		v.found = true
+	}
+}
+
+// hasPlaceholders determines if the template has any expressions to evaluate
+func (t *template) hasPlaceholders() bool {
+	return len(t.expressions) > 0
+}
+
+// evalTyped evaluates the template, a template that is a single placeholder returns the typed expression result
+func (t *template) evalTyped(env map[string]any) (any, error) {
+	switch {
+	case !t.hasPlaceholders():
+		return t.source, nil
+	case t.typed:
+		return runExpression(t.expressions[0], env)
+	default:
+		res, _, err := t.evalString(env)
+		return res, err
+	}
+}
+
+// evalString evaluates the template into a string, matched is true when any placeholder produced a non-empty value
+func (t *template) evalString(env map[string]any) (string, bool, error) {
+	if !t.hasPlaceholders() {
+		// nothing to replace so we report that we matched because this string should be used for those who care about matching
+		return t.source, t.source != "", nil
+	}
+
+	var result strings.Builder
+	var matched []bool
+
+	for i, compiled := range t.expressions {
+		value, err := runExpression(compiled, env)
+		if err != nil {
+			return "", false, err
+		}
+
+		switch value.(type) {
+		case string:
+			if value == "" {
+				matched = append(matched, false)
+			} else {
+				matched = append(matched, true)
+			}
+		case nil:
+			matched = append(matched, false)
+		default:
+			matched = append(matched, true)
+		}
+
+		result.WriteString(t.literals[i])
+		result.WriteString(fmt.Sprint(value))
+	}
+
+	// Append any remainder after last match
+	result.WriteString(t.literals[len(t.literals)-1])
+
+	return result.String(), slices.Contains(matched, true), nil
+}
+
+// evalCandidates evaluates the template into the keys it selects. A placeholder producing a list expands into one key
+// per element in order, with many lists every combination is produced. Like evalString keys are only selected when any
+// placeholder produced a non-empty value
+func (t *template) evalCandidates(env map[string]any) ([]string, error) {
+	if !t.hasPlaceholders() {
+		if t.source == "" {
+			return nil, nil
+		}
+		return []string{t.source}, nil
+	}
+
+	type candidate struct {
+		key     string
+		matched bool
+	}
+
+	candidates := []candidate{{key: t.literals[0]}}
+
+	for i, compiled := range t.expressions {
+		value, err := runExpression(compiled, env)
+		if err != nil {
+			return nil, err
+		}
+
+		values := []any{value}
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice {
+			values = make([]any, rv.Len())
+			for j := range values {
+				values[j] = rv.Index(j).Interface()
+			}
+		}
+
+		var expanded []candidate
+		for _, c := range candidates {
+			for _, v := range values {
+				matched := v != nil && v != ""
+				expanded = append(expanded, candidate{
+					key:     c.key + fmt.Sprint(v) + t.literals[i+1],
+					matched: c.matched || matched,
+				})
+			}
+		}
+		candidates = expanded
+	}
+
+	var keys []string
+	for _, c := range candidates {
+		if c.matched {
+			keys = append(keys, c.key)
+		}
+	}
+
+	return keys, nil
+}
+
+// compileValue walks a data structure and replaces all strings holding placeholders with compiled templates.
+// Maps and slices are copied so the result does not share state with the input.
+func compileValue(value any) (any, error) {
+	switch typed := value.(type) {
+	case string:
+		t, err := compileTemplate(typed)
+		if err != nil {
+			return nil, err
+		}
+		if !t.hasPlaceholders() {
+			return typed, nil
+		}
+		return t, nil
+	case map[string]any:
+		result := make(map[string]any, len(typed))
+		for key, val := range typed {
+			compiled, err := compileValue(val)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = compiled
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(typed))
+		for i, val := range typed {
+			compiled, err := compileValue(val)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = compiled
+		}
+		return result, nil
+	default:
+		return typed, nil
+	}
+}
+
+// evalValue walks a structure produced by compileValue and evaluates all templates using env.
+// Maps and slices are copied so the compiled structure can be reused. Templates that call data() are left in place
+// to be evaluated once all layers are merged.
+func evalValue(value any, env map[string]any) (any, error) {
+	switch typed := value.(type) {
+	case *template:
+		if !typed.refsData {
+			return typed.evalTyped(env)
+		}
+		if captures, ok := env[capturesVariable].([]any); ok {
+			bound := *typed
+			bound.captures = captures
+			return &bound, nil
+		}
+		return typed, nil
+	case map[string]any:
+		result := make(map[string]any, len(typed))
+		for key, val := range typed {
+			expanded, err := evalValue(val, env)
+			if err != nil {
+				return nil, undefinedAt(err, key)
+			}
+			result[key] = expanded
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(typed))
+		for i, val := range typed {
+			expanded, err := evalValue(val, env)
+			if err != nil {
+				return nil, undefinedAt(err, strconv.Itoa(i))
+			}
+			result[i] = expanded
+		}
+		return result, nil
+	default:
+		return typed, nil
+	}
+}
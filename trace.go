@@ -0,0 +1,256 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// TraceLayer describes a hierarchy layer that supplied a value
+type TraceLayer struct {
+	// Layer is the data key or the interpolated override key that supplied the value
+	Layer string `json:"layer"`
+	// Entry is the hierarchy order entry that produced Layer, empty for the base data
+	Entry string `json:"entry,omitempty"`
+	// Pattern is the glob or regular expression override key that matched Layer, empty for exact keys
+	Pattern string `json:"pattern,omitempty"`
+	// Value is the value the layer supplied
+	Value any `json:"value"`
+}
+
+// TraceEntry describes where a leaf value in the resolved data came from
+type TraceEntry struct {
+	// Path is the gjson path to the value in the resolved data
+	Path string `json:"path"`
+
+	TraceLayer
+
+	// Shadowed lists the earlier layers that set this path, oldest first
+	Shadowed []TraceLayer `json:"shadowed,omitempty"`
+}
+
+// ResolveWithTrace behaves like Resolve but also reports the origin of every leaf value in the result
+func ResolveWithTrace(root map[string]any, facts map[string]any, opts Options, log Logger) (map[string]any, []TraceEntry, error) {
+	if log != nil {
+		opts.Logger = log
+	}
+
+	resolver, err := New(root, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resolver.ResolveWithTrace(context.Background(), facts)
+}
+
+// ResolveWithTrace evaluates the compiled document against facts and reports the origin of every leaf value in the result, sorted by path
+func (r *Resolver) ResolveWithTrace(ctx context.Context, facts map[string]any) (map[string]any, []TraceEntry, error) {
+	trace := newTracer()
+
+	res, err := r.resolve(ctx, facts, trace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res, trace.entries(), nil
+}
+
+// leaf is a value found at the end of a path in a data structure
+type leaf struct {
+	segments []string
+	value    any
+}
+
+// tracer tracks the layer that supplied every leaf as layers are merged
+type tracer struct {
+	origins map[string]*TraceEntry
+}
+
+func newTracer() *tracer {
+	return &tracer{origins: map[string]*TraceEntry{}}
+}
+
+// record compares the data before and after merging a layer, any leaf that was added, changed or explicitly set by
+// the candidate layer is attributed to the layer and the previous origin, if any, is marked as shadowed. Entries of
+// merged slices are followed to where they were before the merge using sliceOrigins
+func (t *tracer) record(layer string, entry string, pattern string, previous map[string]any, merged map[string]any, candidate map[string]any, sliceOrigins map[string][]entryOrigin) {
+	before := collectLeaves(previous)
+	after := collectLeaves(merged)
+
+	origins := make(map[string]*TraceEntry, len(after))
+
+	for path, current := range after {
+		var existing *TraceEntry
+		var old leaf
+		existed, hadLeaf := false, false
+
+		previousSegments, found, explicit := locateLeaf(current.segments, sliceOrigins, candidate)
+		if found {
+			previousPath := tracePath(previousSegments)
+			existing, existed = t.origins[previousPath]
+			old, hadLeaf = before[previousPath]
+		}
+
+		if existed && hadLeaf && reflect.DeepEqual(old.value, current.value) && !explicit {
+			moved := *existing
+			moved.Path = path
+			origins[path] = &moved
+			continue
+		}
+
+		origin := &TraceEntry{
+			Path:       path,
+			TraceLayer: TraceLayer{Layer: layer, Entry: entry, Pattern: pattern, Value: current.value},
+		}
+
+		if existed {
+			origin.Shadowed = append(slices.Clone(existing.Shadowed), existing.TraceLayer)
+		}
+
+		origins[path] = origin
+	}
+
+	t.origins = origins
+}
+
+// resolveTemplates replaces templates that call data(), which are only evaluated once all layers are merged, with
+// their result from data or with their source in shadowed layers where they were never evaluated
+func (t *tracer) resolveTemplates(data map[string]any) {
+	for _, origin := range t.origins {
+		if _, ok := origin.Value.(*template); ok {
+			origin.Value, _ = valueAt(data, splitPath(origin.Path))
+		}
+
+		for i, shadowed := range origin.Shadowed {
+			if tpl, ok := shadowed.Value.(*template); ok {
+				origin.Shadowed[i].Value = tpl.source
+			}
+		}
+	}
+}
+
+// entries returns all recorded origins sorted by path
+func (t *tracer) entries() []TraceEntry {
+	result := make([]TraceEntry, 0, len(t.origins))
+	for _, origin := range t.origins {
+		result = append(result, *origin)
+	}
+
+	slices.SortFunc(result, func(a, b TraceEntry) int {
+		return comparePaths(a.Path, b.Path)
+	})
+
+	return result
+}
+
+// collectLeaves finds all leaf values in data keyed by their gjson path, empty maps and slices are considered leaves
+func collectLeaves(data map[string]any) map[string]leaf {
+	leaves := map[string]leaf{}
+	for key, value := range data {
+		walkLeaves([]string{key}, value, leaves)
+	}
+
+	return leaves
+}
+
+func walkLeaves(segments []string, value any, leaves map[string]leaf) {
+	switch typed := value.(type) {
+	case map[string]any:
+		if len(typed) > 0 {
+			for key, val := range typed {
+				walkLeaves(append(slices.Clone(segments), key), val, leaves)
+			}
+			return
+		}
+	case []any:
+		if len(typed) > 0 {
+			for i, val := range typed {
+				walkLeaves(append(slices.Clone(segments), strconv.Itoa(i)), val, leaves)
+			}
+			return
+		}
+	}
+
+	leaves[tracePath(segments)] = leaf{segments: segments, value: value}
+}
+
+// locateLeaf finds where the leaf at segments in merged data was before the merge and if the candidate layer
+// explicitly set it. Slice entries recorded in sliceOrigins are followed to their index in the previous data and in
+// the candidate, found is false when the leaf is in an entry that came from the candidate only. Entries of slices that
+// were not recorded are never considered explicit since merging might have moved the items around
+func locateLeaf(segments []string, sliceOrigins map[string][]entryOrigin, candidate map[string]any) (previous []string, found bool, explicit bool) {
+	var current any = candidate
+	explicit = true
+
+	for i, segment := range segments {
+		entries, recorded := sliceOrigins[tracePath(segments[:i])]
+		idx, err := strconv.Atoi(segment)
+		if !recorded || err != nil || idx < 0 || idx >= len(entries) {
+			previous = append(previous, segment)
+
+			m, ok := current.(map[string]any)
+			if explicit && ok {
+				current, explicit = m[segment]
+			} else {
+				explicit = false
+			}
+
+			continue
+		}
+
+		origin := entries[idx]
+		if origin.existing < 0 {
+			return nil, false, true
+		}
+		previous = append(previous, strconv.Itoa(origin.existing))
+
+		list, ok := current.([]any)
+		if explicit && ok && origin.incoming >= 0 && origin.incoming < len(list) {
+			current = list[origin.incoming]
+		} else {
+			explicit = false
+		}
+	}
+
+	return previous, true, explicit
+}
+
+// tracePath creates a gjson path from path segments
+func tracePath(segments []string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = gjson.Escape(segment)
+	}
+
+	return strings.Join(escaped, ".")
+}
+
+// comparePaths orders gjson paths segment by segment with numeric segments ordered numerically
+func comparePaths(a string, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+
+		ai, aErr := strconv.Atoi(as[i])
+		bi, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			return ai - bi
+		}
+
+		return strings.Compare(as[i], bs[i])
+	}
+
+	return len(as) - len(bs)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2025, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tinyhiera
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResolveWithTrace", func() {
+	data := map[string]any{
+		"hierarchy": map[string]any{
+			"order": []any{"env:{{ lookup('env') }}", "role:{{ lookup('role') }}", "global"},
+			"merge": "deep",
+		},
+		"data": map[string]any{
+			"log_level": "INFO",
+			"packages":  []any{"ca-certificates"},
+			"web": map[string]any{
+				"listen_port": 80,
+				"tls":         false,
+			},
+			"dotted.key": "x",
+		},
+		"overrides": map[string]any{
+			"env:prod": map[string]any{
+				"log_level": "WARN",
+			},
+			"role:web": map[string]any{
+				"log_level": "ERROR",
+				"packages":  []any{"nginx"},
+				"web": map[string]any{
+					"tls": true,
+				},
+			},
+			"global": map[string]any{
+				"web": map[string]any{
+					"listen_port": 80,
+				},
+			},
+		},
+	}
+
+	It("Should report the origin of every leaf", func() {
+		result, trace, err := ResolveWithTrace(data, map[string]any{"env": "prod", "role": "web"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["log_level"]).To(Equal("ERROR"))
+
+		Expect(trace).To(Equal([]TraceEntry{
+			{Path: `dotted\.key`, TraceLayer: TraceLayer{Layer: "data", Value: "x"}},
+			{
+				Path:       "log_level",
+				TraceLayer: TraceLayer{Layer: "role:web", Entry: "role:{{ lookup('role') }}", Value: "ERROR"},
+				Shadowed: []TraceLayer{
+					{Layer: "data", Value: "INFO"},
+					{Layer: "env:prod", Entry: "env:{{ lookup('env') }}", Value: "WARN"},
+				},
+			},
+			{Path: "packages.0", TraceLayer: TraceLayer{Layer: "data", Value: "ca-certificates"}},
+			{Path: "packages.1", TraceLayer: TraceLayer{Layer: "role:web", Entry: "role:{{ lookup('role') }}", Value: "nginx"}},
+			{
+				Path:       "web.listen_port",
+				TraceLayer: TraceLayer{Layer: "global", Entry: "global", Value: 80},
+				Shadowed:   []TraceLayer{{Layer: "data", Value: 80}},
+			},
+			{
+				Path:       "web.tls",
+				TraceLayer: TraceLayer{Layer: "role:web", Entry: "role:{{ lookup('role') }}", Value: true},
+				Shadowed:   []TraceLayer{{Layer: "data", Value: false}},
+			},
+		}))
+	})
+
+	It("Should only trace the first matching layer in first merge mode", func() {
+		root := cloneMap(data)
+		root["hierarchy"] = map[string]any{
+			"order": []any{"env:{{ lookup('env') }}", "role:{{ lookup('role') }}"},
+			"merge": "first",
+		}
+
+		_, trace, err := ResolveWithTrace(root, map[string]any{"env": "prod", "role": "web"}, DefaultOptions, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(trace).To(ContainElement(TraceEntry{
+			Path:       "log_level",
+			TraceLayer: TraceLayer{Layer: "env:prod", Entry: "env:{{ lookup('env') }}", Value: "WARN"},
+			Shadowed:   []TraceLayer{{Layer: "data", Value: "INFO"}},
+		}))
+		Expect(trace).To(ContainElement(TraceEntry{
+			Path:       "web.tls",
+			TraceLayer: TraceLayer{Layer: "data", Value: false},
+		}))
+	})
+
+	Describe("list entries", func() {
+		role := "role:{{ lookup('role') }}"
+		facts := map[string]any{"role": "web"}
+
+		document := func(hierarchy map[string]any, packages []any, override []any) map[string]any {
+			hierarchy["order"] = []any{role}
+			hierarchy["merge"] = "deep"
+
+			return map[string]any{
+				"hierarchy": hierarchy,
+				"data":      map[string]any{"packages": packages},
+				"overrides": map[string]any{"role:web": map[string]any{"packages": override}},
+			}
+		}
+
+		It("Should follow entries moved by prepend", func() {
+			_, trace, err := ResolveWithTrace(document(map[string]any{"array_merge": "prepend"}, []any{"curl"}, []any{"nginx"}), facts, DefaultOptions, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trace).To(Equal([]TraceEntry{
+				{Path: "packages.0", TraceLayer: TraceLayer{Layer: "role:web", Entry: role, Value: "nginx"}},
+				{Path: "packages.1", TraceLayer: TraceLayer{Layer: "data", Value: "curl"}},
+			}))
+		})
+
+		It("Should follow entries moved by knockouts", func() {
+			hierarchy := map[string]any{"knockout_prefix": "--"}
+			_, trace, err := ResolveWithTrace(document(hierarchy, []any{"ca-certificates", "curl"}, []any{"--ca-certificates", "nginx"}), facts, DefaultOptions, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trace).To(Equal([]TraceEntry{
+				{Path: "packages.0", TraceLayer: TraceLayer{Layer: "data", Value: "curl"}},
+				{Path: "packages.1", TraceLayer: TraceLayer{Layer: "role:web", Entry: role, Value: "nginx"}},
+			}))
+		})
+
+		It("Should keep the first layer setting duplicates with unique", func() {
+			_, trace, err := ResolveWithTrace(document(map[string]any{"array_merge": "unique"}, []any{"curl", "nginx"}, []any{"haproxy", "curl"}), facts, DefaultOptions, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trace).To(Equal([]TraceEntry{
+				{Path: "packages.0", TraceLayer: TraceLayer{Layer: "data", Value: "curl"}},
+				{Path: "packages.1", TraceLayer: TraceLayer{Layer: "data", Value: "nginx"}},
+				{Path: "packages.2", TraceLayer: TraceLayer{Layer: "role:web", Entry: role, Value: "haproxy"}},
+			}))
+		})
+
+		It("Should attribute keys of maps merged by key", func() {
+			root := document(map[string]any{"knockout_prefix": "--"},
+				[]any{
+					map[string]any{"name": "curl", "version": "8"},
+					map[string]any{"name": "nginx", "version": "1.24", "ensure": "present"},
+				},
+				[]any{
+					map[string]any{"name": "--curl"},
+					map[string]any{"name": "haproxy", "version": "3"},
+					map[string]any{"name": "nginx", "version": "1.26"},
+				},
+			)
+			root["lookup_options"] = map[string]any{"packages": map[string]any{"array_merge": "by_key", "merge_key": "name"}}
+
+			_, trace, err := ResolveWithTrace(root, facts, DefaultOptions, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trace).To(Equal([]TraceEntry{
+				{Path: "packages.0.ensure", TraceLayer: TraceLayer{Layer: "data", Value: "present"}},
+				{
+					Path:       "packages.0.name",
+					TraceLayer: TraceLayer{Layer: "role:web", Entry: role, Value: "nginx"},
+					Shadowed:   []TraceLayer{{Layer: "data", Value: "nginx"}},
+				},
+				{
+					Path:       "packages.0.version",
+					TraceLayer: TraceLayer{Layer: "role:web", Entry: role, Value: "1.26"},
+					Shadowed:   []TraceLayer{{Layer: "data", Value: "1.24"}},
+				},
+				{Path: "packages.1.name", TraceLayer: TraceLayer{Layer: "role:web", Entry: role, Value: "haproxy"}},
+				{Path: "packages.1.version", TraceLayer: TraceLayer{Layer: "role:web", Entry: role, Value: "3"}},
+			}))
+		})
+	})
+})
+
+var _ = Describe("comparePaths", func() {
+	It("Should sort numeric segments numerically", func() {
+		Expect(comparePaths("list.2", "list.10")).To(BeNumerically("<", 0))
+		Expect(comparePaths("a.b", "a")).To(BeNumerically(">", 0))
+		Expect(comparePaths("a.b", "a.c")).To(BeNumerically("<", 0))
+	})
+})